@@ -21,6 +21,9 @@ func (a *App) startup(ctx context.Context) {
 	log.Info().Ctx(ctx).Msg("Ollama Desktop startup...")
 	a.ctx = ctx
 	dao.startup(ctx)
+	chat.interruptRunningMessages()
+	completion.interruptRunningCompletions()
+	downloader.startup()
 	job.GetSchedule().AddFunc("0/10 * * * * ?", ollama.Heartbeat)
 }
 
@@ -0,0 +1,447 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"strings"
+	"sync"
+	"time"
+)
+
+var arena = Arena{}
+
+const (
+	// 单个回答完成时发送，包含回答的统计信息
+	eventArenaAnswer = "arena_answer"
+	// 所有模型回答完成时发送
+	eventArenaDone = "arena_done"
+
+	maxArenaModels = 8
+)
+
+// Arena 模型对比，将同一问题同时发送给多个模型并比较回答
+type Arena struct {
+	// 正在进行中的对比，用于取消
+	cancels map[string]context.CancelFunc
+	lock    sync.Mutex
+}
+
+type ArenaModel struct {
+	Id              string    `json:"id"`
+	SystemMessage   string    `json:"systemMessage"`
+	QuestionContent string    `json:"questionContent"`
+	Options         string    `json:"options"`
+	WinnerAnswerId  string    `json:"winnerAnswerId"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+
+	Answers []*ArenaAnswerModel `json:"answers,omitempty"`
+}
+
+type ArenaAnswerModel struct {
+	Id                 string        `json:"id"`
+	ArenaId            string        `json:"arenaId"`
+	ModelName          string        `json:"modelName"`
+	AnswerContent      string        `json:"answerContent"`
+	TotalDuration      time.Duration `json:"totalDuration"`
+	LoadDuration       time.Duration `json:"loadDuration"`
+	PromptEvalCount    int           `json:"promptEvalCount"`
+	PromptEvalDuration time.Duration `json:"promptEvalDuration"`
+	EvalCount          int           `json:"evalCount"`
+	EvalDuration       time.Duration `json:"evalDuration"`
+	DoneReason         string        `json:"doneReason"`
+	IsSuccess          bool          `json:"isSuccess"`
+	CreatedAt          time.Time     `json:"createdAt"`
+	UpdatedAt          time.Time     `json:"updatedAt"`
+
+	// 每秒生成的 token 数量
+	TokensPerSecond float64 `json:"tokensPerSecond"`
+}
+
+func (a *ArenaAnswerModel) tokensPerSecond() float64 {
+	if a.EvalDuration <= 0 {
+		return 0
+	}
+	return float64(a.EvalCount) / a.EvalDuration.Seconds()
+}
+
+type ArenaRequest struct {
+	ModelNames    []string               `json:"modelNames"`
+	SystemMessage string                 `json:"systemMessage"`
+	Content       string                 `json:"content"`
+	Images        []*ChatAttachmentModel `json:"images"`
+	// 会话参数格式，所有模型使用相同的参数
+	Options string `json:"options"`
+}
+
+// StartArena 将同一问题同时发送给多个模型，每个回答以回答编号为事件名称按 ChatStreamDelta 格式流式返回，图片不会被保存
+func (a *Arena) StartArena(request *ArenaRequest) (*ArenaModel, error) {
+	var modelNames []string
+	exists := make(map[string]bool)
+	for _, modelName := range request.ModelNames {
+		if modelName = strings.TrimSpace(modelName); modelName != "" && !exists[modelName] {
+			exists[modelName] = true
+			modelNames = append(modelNames, modelName)
+		}
+	}
+	if len(modelNames) < 2 {
+		return nil, errors.New("at least two models are required")
+	}
+	if len(modelNames) > maxArenaModels {
+		return nil, errors.New("too many models")
+	}
+	if strings.TrimSpace(request.Content) == "" {
+		return nil, errors.New("content is required")
+	}
+	options, err := sessionOptions(&SessionModel{Options: request.Options})
+	if err != nil {
+		return nil, err
+	}
+	images, err := chat.prepareImages("", "", request.Images)
+	if err != nil {
+		log.Error().Err(err).Msg("prepare images error")
+		return nil, err
+	}
+
+	now := time.Now()
+	model := &ArenaModel{
+		Id:              uuid.NewString(),
+		SystemMessage:   request.SystemMessage,
+		QuestionContent: request.Content,
+		Options:         request.Options,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	for _, modelName := range modelNames {
+		model.Answers = append(model.Answers, &ArenaAnswerModel{
+			Id:        uuid.NewString(),
+			ArenaId:   model.Id,
+			ModelName: modelName,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+	if err := dao.transaction(func(tx *sql.Tx) error {
+		return a.insertArena(tx, model)
+	}); err != nil {
+		return nil, err
+	}
+
+	var messages []olm.Message
+	if request.SystemMessage != "" {
+		messages = append(messages, olm.Message{
+			Role:    messageRoleSystem,
+			Content: request.SystemMessage,
+		})
+	}
+	messages = append(messages, olm.Message{
+		Role:    messageRoleUser,
+		Content: request.Content,
+		Images:  imageData(images),
+	})
+
+	ctx, cancel := context.WithCancel(app.ctx)
+	a.addCancel(model.Id, cancel)
+	go func() {
+		defer a.removeCancel(model.Id)
+		var wg sync.WaitGroup
+		for _, answer := range model.Answers {
+			wg.Add(1)
+			go func(answer *ArenaAnswerModel) {
+				defer wg.Done()
+				a.chat(ctx, answer, &olm.ChatRequest{
+					Model:    answer.ModelName,
+					Messages: messages,
+					Options:  options,
+				})
+			}(answer)
+		}
+		wg.Wait()
+		runtime.EventsEmit(app.ctx, eventArenaDone, model.Id)
+	}()
+	return model, nil
+}
+
+func (a *Arena) chat(ctx context.Context, answer *ArenaAnswerModel, request *olm.ChatRequest) {
+	defer a.updateAnswer(answer)
+	stream := newChatStream(answer.Id)
+	var buffer bytes.Buffer
+	err := ollama.newApiClient().Chat(ctx, request, func(response olm.ChatResponse) error {
+		buffer.WriteString(response.Message.Content)
+		if !response.Done {
+			stream.append(response.Message.Content)
+			return nil
+		}
+		metrics := response.Metrics
+		answer.TotalDuration = metrics.TotalDuration
+		answer.LoadDuration = metrics.LoadDuration
+		answer.PromptEvalCount = metrics.PromptEvalCount
+		answer.PromptEvalDuration = metrics.PromptEvalDuration
+		answer.EvalCount = metrics.EvalCount
+		answer.EvalDuration = metrics.EvalDuration
+		answer.DoneReason = response.DoneReason
+		answer.IsSuccess = true
+		answer.AnswerContent = buffer.String()
+		answer.UpdatedAt = response.CreatedAt
+		stream.finish(answer.AnswerContent, true)
+		return nil
+	})
+	if err == nil {
+		return
+	}
+	answer.UpdatedAt = time.Now()
+	if ctx.Err() != nil {
+		answer.IsSuccess = true
+		answer.DoneReason = doneReasonCanceled
+		answer.AnswerContent = buffer.String()
+		stream.finish(answer.AnswerContent, true)
+		return
+	}
+	log.Error().Err(err).Str("model", answer.ModelName).Msg("arena chat error")
+	answer.IsSuccess = false
+	answer.DoneReason = err.Error()
+	answer.AnswerContent = err.Error()
+	stream.finish(answer.AnswerContent, false)
+}
+
+// StopArena 取消对比中所有未完成的回答
+func (a *Arena) StopArena(arenaId string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if cancel, ok := a.cancels[arenaId]; ok {
+		cancel()
+	}
+}
+
+func (a *Arena) addCancel(arenaId string, cancel context.CancelFunc) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.cancels == nil {
+		a.cancels = make(map[string]context.CancelFunc)
+	}
+	a.cancels[arenaId] = cancel
+}
+
+func (a *Arena) removeCancel(arenaId string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if cancel, ok := a.cancels[arenaId]; ok {
+		cancel()
+		delete(a.cancels, arenaId)
+	}
+}
+
+func (a *Arena) insertArena(tx *sql.Tx, model *ArenaModel) error {
+	sqlStr := `insert into t_arena(id, system_message, question_content, options, winner_answer_id, created_at, updated_at)
+               values (?, ?, ?, ?, ?, ?, ?)`
+	if _, err := tx.ExecContext(app.ctx, sqlStr, model.Id, model.SystemMessage, model.QuestionContent, model.Options,
+		model.WinnerAnswerId, model.CreatedAt, model.UpdatedAt); err != nil {
+		log.Error().Err(err).Msg("create arena error")
+		return err
+	}
+	sqlStr = `insert into t_arena_answer(` + arenaAnswerColumns + `)
+              values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, answer := range model.Answers {
+		if _, err := tx.ExecContext(app.ctx, sqlStr, answer.Id, answer.ArenaId, answer.ModelName, answer.AnswerContent,
+			answer.TotalDuration, answer.LoadDuration, answer.PromptEvalCount, answer.PromptEvalDuration,
+			answer.EvalCount, answer.EvalDuration, answer.DoneReason, answer.IsSuccess,
+			answer.CreatedAt, answer.UpdatedAt); err != nil {
+			log.Error().Err(err).Msg("create arena answer error")
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Arena) updateAnswer(answer *ArenaAnswerModel) {
+	sqlStr := `update t_arena_answer set answer_content = ?, total_duration = ?, load_duration = ?, prompt_eval_count = ?,
+                   prompt_eval_duration = ?, eval_count = ?, eval_duration = ?, done_reason = ?, is_success = ?, updated_at = ?
+               where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, answer.AnswerContent, answer.TotalDuration, answer.LoadDuration,
+		answer.PromptEvalCount, answer.PromptEvalDuration, answer.EvalCount, answer.EvalDuration, answer.DoneReason,
+		answer.IsSuccess, answer.UpdatedAt, answer.Id); err != nil {
+		log.Error().Err(err).Msg("update arena answer error")
+	}
+	answer.TokensPerSecond = answer.tokensPerSecond()
+	runtime.EventsEmit(app.ctx, eventArenaAnswer, answer)
+}
+
+const arenaAnswerColumns = `id, arena_id, model_name, answer_content, total_duration, load_duration, prompt_eval_count,
+                 prompt_eval_duration, eval_count, eval_duration, done_reason, is_success, created_at, updated_at`
+
+func (a *Arena) scanAnswer(rows *sql.Rows) (*ArenaAnswerModel, error) {
+	answer := &ArenaAnswerModel{}
+	if err := rows.Scan(&answer.Id, &answer.ArenaId, &answer.ModelName, &answer.AnswerContent,
+		&answer.TotalDuration, &answer.LoadDuration, &answer.PromptEvalCount, &answer.PromptEvalDuration,
+		&answer.EvalCount, &answer.EvalDuration, &answer.DoneReason, &answer.IsSuccess,
+		&answer.CreatedAt, &answer.UpdatedAt); err != nil {
+		return nil, err
+	}
+	answer.TokensPerSecond = answer.tokensPerSecond()
+	return answer, nil
+}
+
+// Arenas 查询历史对比及其回答，按创建时间倒序
+func (a *Arena) Arenas() ([]*ArenaModel, error) {
+	sqlStr := `select id, system_message, question_content, options, winner_answer_id, created_at, updated_at
+            from t_arena
+            order by created_at desc`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr)
+	if err != nil {
+		log.Error().Err(err).Msg("query arena error")
+		return nil, err
+	}
+	defer rows.Close()
+	var arenas []*ArenaModel
+	arenaMap := make(map[string]*ArenaModel)
+	for rows.Next() {
+		model := &ArenaModel{}
+		if err := rows.Scan(&model.Id, &model.SystemMessage, &model.QuestionContent, &model.Options, &model.WinnerAnswerId,
+			&model.CreatedAt, &model.UpdatedAt); err != nil {
+			log.Error().Err(err).Msg("fill arena error")
+			return nil, err
+		}
+		arenas = append(arenas, model)
+		arenaMap[model.Id] = model
+	}
+	rows.Close()
+
+	sqlStr = `select ` + arenaAnswerColumns + `
+            from t_arena_answer
+            order by created_at, model_name`
+	answerRows, err := dao.db().QueryContext(app.ctx, sqlStr)
+	if err != nil {
+		log.Error().Err(err).Msg("query arena answer error")
+		return nil, err
+	}
+	defer answerRows.Close()
+	for answerRows.Next() {
+		answer, err := a.scanAnswer(answerRows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill arena answer error")
+			return nil, err
+		}
+		if model, ok := arenaMap[answer.ArenaId]; ok {
+			model.Answers = append(model.Answers, answer)
+		}
+	}
+	return arenas, nil
+}
+
+func (a *Arena) DeleteArena(id string) (string, error) {
+	return id, dao.transaction(func(tx *sql.Tx) error {
+		sqlStr := "delete from t_arena where id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete arena error")
+			return err
+		}
+		sqlStr = "delete from t_arena_answer where arena_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete arena answer error")
+			return err
+		}
+		return nil
+	})
+}
+
+// VoteArena 为对比投票选择最佳回答，answerId 为空时取消投票
+func (a *Arena) VoteArena(arenaId, answerId string) error {
+	if answerId != "" {
+		sqlStr := `select count(1) from t_arena_answer where id = ? and arena_id = ?`
+		var count int
+		if err := dao.db().QueryRowContext(app.ctx, sqlStr, answerId, arenaId).Scan(&count); err != nil {
+			log.Error().Err(err).Msg("query arena answer error")
+			return err
+		}
+		if count == 0 {
+			return errors.New("arena answer not exists")
+		}
+	}
+	sqlStr := `update t_arena set winner_answer_id = ?, updated_at = ? where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, answerId, time.Now(), arenaId); err != nil {
+		log.Error().Err(err).Msg("vote arena error")
+		return err
+	}
+	return nil
+}
+
+type ArenaModelStats struct {
+	ModelName string `json:"modelName"`
+	// 参与对比的次数
+	Runs int `json:"runs"`
+	// 被投票为最佳回答的次数
+	Wins int `json:"wins"`
+	// 参与且已投票的对比次数
+	Votes              int           `json:"votes"`
+	Failures           int           `json:"failures"`
+	AvgTokensPerSecond float64       `json:"avgTokensPerSecond"`
+	AvgLoadDuration    time.Duration `json:"avgLoadDuration"`
+	AvgTotalDuration   time.Duration `json:"avgTotalDuration"`
+	AvgEvalCount       float64       `json:"avgEvalCount"`
+	LastCreatedAt      time.Time     `json:"lastCreatedAt"`
+}
+
+// ArenaStats 按模型汇总历史对比结果，平均值只统计成功完成的回答
+func (a *Arena) ArenaStats() ([]*ArenaModelStats, error) {
+	arenas, err := a.Arenas()
+	if err != nil {
+		return nil, err
+	}
+	return arenaStats(arenas), nil
+}
+
+func arenaStats(arenas []*ArenaModel) []*ArenaModelStats {
+	var stats []*ArenaModelStats
+	statsMap := make(map[string]*ArenaModelStats)
+	completed := make(map[string][]*ArenaAnswerModel)
+	for _, model := range arenas {
+		for _, answer := range model.Answers {
+			stat, ok := statsMap[answer.ModelName]
+			if !ok {
+				stat = &ArenaModelStats{ModelName: answer.ModelName}
+				statsMap[answer.ModelName] = stat
+				stats = append(stats, stat)
+			}
+			stat.Runs++
+			if model.WinnerAnswerId != "" {
+				stat.Votes++
+				if model.WinnerAnswerId == answer.Id {
+					stat.Wins++
+				}
+			}
+			if answer.CreatedAt.After(stat.LastCreatedAt) {
+				stat.LastCreatedAt = answer.CreatedAt
+			}
+			if !answer.IsSuccess {
+				stat.Failures++
+			} else if answer.DoneReason != doneReasonCanceled {
+				completed[answer.ModelName] = append(completed[answer.ModelName], answer)
+			}
+		}
+	}
+	for _, stat := range stats {
+		answers := completed[stat.ModelName]
+		if len(answers) == 0 {
+			continue
+		}
+		evalCount := 0
+		for _, answer := range answers {
+			stat.AvgTokensPerSecond += answer.TokensPerSecond
+			stat.AvgLoadDuration += answer.LoadDuration
+			stat.AvgTotalDuration += answer.TotalDuration
+			evalCount += answer.EvalCount
+		}
+		count := len(answers)
+		stat.AvgTokensPerSecond /= float64(count)
+		stat.AvgLoadDuration /= time.Duration(count)
+		stat.AvgTotalDuration /= time.Duration(count)
+		stat.AvgEvalCount = float64(evalCount) / float64(count)
+	}
+	return stats
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestArenaStats(t *testing.T) {
+	arenas := []*ArenaModel{
+		{
+			WinnerAnswerId: "a1",
+			Answers: []*ArenaAnswerModel{
+				{Id: "a1", ModelName: "llama3", IsSuccess: true, EvalCount: 100, EvalDuration: 2 * time.Second, LoadDuration: time.Second},
+				{Id: "a2", ModelName: "qwen2", IsSuccess: true, EvalCount: 60, EvalDuration: 3 * time.Second, LoadDuration: 3 * time.Second},
+			},
+		},
+		{
+			Answers: []*ArenaAnswerModel{
+				{Id: "b1", ModelName: "llama3", IsSuccess: true, EvalCount: 150, EvalDuration: time.Second, LoadDuration: 3 * time.Second},
+				{Id: "b2", ModelName: "qwen2", IsSuccess: false, DoneReason: "model not found"},
+			},
+		},
+	}
+	for _, model := range arenas {
+		for _, answer := range model.Answers {
+			answer.TokensPerSecond = answer.tokensPerSecond()
+		}
+	}
+	stats := arenaStats(arenas)
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 models, got %d", len(stats))
+	}
+	llama, qwen := stats[0], stats[1]
+	if llama.ModelName != "llama3" || llama.Runs != 2 || llama.Wins != 1 || llama.Votes != 1 || llama.Failures != 0 {
+		t.Errorf("unexpected stats %+v", llama)
+	}
+	if llama.AvgTokensPerSecond != 100 || llama.AvgLoadDuration != 2*time.Second || llama.AvgEvalCount != 125 {
+		t.Errorf("unexpected average %+v", llama)
+	}
+	if qwen.Runs != 2 || qwen.Wins != 0 || qwen.Votes != 1 || qwen.Failures != 1 || qwen.AvgTokensPerSecond != 20 {
+		t.Errorf("unexpected stats %+v", qwen)
+	}
+}
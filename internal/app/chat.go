@@ -2,36 +2,56 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
-	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"ollama-desktop/internal/log"
 	olm "ollama-desktop/internal/ollama"
-	"strconv"
+	"sync"
 	"time"
 )
 
 var chat = Chat{}
 
+const doneReasonCanceled = "canceled"
+
 type Chat struct {
+	// 正在进行中的回答，用于取消回答
+	cancels map[string]context.CancelFunc
+	// 正在生成摘要的会话
+	summarizing map[string]bool
+	// 各会话的问答队列
+	queues map[string]*chatQueue
+	// 进行中及排队中的回答流
+	streams map[string]*chatStream
+	lock    sync.Mutex
 }
 
+const sessionColumns = `id, session_name, model_name, message_history_count, keep_alive, system_message, options, tools,
+                 active_message_id, summary_enabled, summary_model_name, summary, summary_message_id, name_source,
+                 response_format, format_retries, knowledge_bases, folder_id, pinned, archived, created_at, updated_at`
+
 func (c *Chat) scanSession(rows *sql.Rows) (*SessionModel, error) {
 	session := &SessionModel{}
 	if err := rows.Scan(&session.Id, &session.SessionName, &session.ModelName,
-		&session.MessageHistoryCount, &session.KeepAlive, &session.SystemMessage, &session.Options, &session.CreatedAt, &session.UpdatedAt); err != nil {
+		&session.MessageHistoryCount, &session.KeepAlive, &session.SystemMessage, &session.Options, &session.Tools, &session.ActiveMessageId,
+		&session.SummaryEnabled, &session.SummaryModelName, &session.Summary, &session.SummaryMessageId, &session.NameSource,
+		&session.ResponseFormat, &session.FormatRetries, &session.KnowledgeBases, &session.FolderId, &session.Pinned,
+		&session.Archived, &session.CreatedAt, &session.UpdatedAt); err != nil {
 		return nil, err
 	}
 	return session, nil
 }
 
-func (c *Chat) Sessions() ([]*SessionModel, error) {
-	sqlStr := `select id, session_name, model_name, message_history_count, keep_alive, system_message, options, created_at, updated_at
-            from t_session
-            order by created_at desc`
-	rows, err := dao.db().QueryContext(app.ctx, sqlStr)
+// Sessions 按过滤条件分页查询会话，filters 为空时返回全部未归档的会话
+func (c *Chat) Sessions(filters *SessionFilters) ([]*SessionModel, error) {
+	sqlStr, args, err := sessionQuery(filters)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, args...)
 	if err != nil {
 		log.Error().Err(err).Msg("query session error")
 		return nil, err
@@ -46,22 +66,52 @@ func (c *Chat) Sessions() ([]*SessionModel, error) {
 		}
 		sessions = append(sessions, session)
 	}
+	rows.Close()
+	if err := c.fillSessionTags(sessions); err != nil {
+		return nil, err
+	}
 	return sessions, nil
 }
 
+// CreateSession 创建会话，未填写会话名称时在首次回答成功后自动生成标题
 func (c *Chat) CreateSession(session *SessionModel) (*SessionModel, error) {
 	session.Id = uuid.NewString()
+	session.SessionName, session.NameSource = sessionName(session.SessionName)
 	session.CreatedAt = time.Now()
 	session.UpdatedAt = session.CreatedAt
+	if session.FolderId != "" {
+		if _, err := c.getFolder(session.FolderId); err != nil {
+			return nil, err
+		}
+	}
+
+	return session, dao.transaction(func(tx *sql.Tx) error {
+		return c.insertSession(tx, session)
+	})
+}
 
-	sqlStr := `insert into t_session(id, session_name, model_name, message_history_count, keep_alive, system_message, options, created_at, updated_at)
-               values (?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	_, err := dao.db().ExecContext(app.ctx, sqlStr, session.Id, session.SessionName, session.ModelName,
-		session.MessageHistoryCount, session.KeepAlive, session.SystemMessage, session.Options, session.CreatedAt, session.UpdatedAt)
-	return session, err
+func (c *Chat) insertSession(tx *sql.Tx, session *SessionModel) error {
+	tags, err := normalizeTags(session.Tags)
+	if err != nil {
+		return err
+	}
+	session.Tags = tags
+	sqlStr := `insert into t_session(` + sessionColumns + `)
+               values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.ExecContext(app.ctx, sqlStr, session.Id, session.SessionName, session.ModelName,
+		session.MessageHistoryCount, session.KeepAlive, session.SystemMessage, session.Options, session.Tools, session.ActiveMessageId,
+		session.SummaryEnabled, session.SummaryModelName, session.Summary, session.SummaryMessageId, session.NameSource,
+		session.ResponseFormat, session.FormatRetries, session.KnowledgeBases, session.FolderId, session.Pinned,
+		session.Archived, session.CreatedAt, session.UpdatedAt)
+	if err != nil {
+		log.Error().Err(err).Msg("create session error")
+		return err
+	}
+	return c.replaceSessionTags(tx, session.Id, session.Tags)
 }
 
 func (c *Chat) DeleteSession(id string) (string, error) {
+	c.clearQueue(id)
 	return id, dao.transaction(func(tx *sql.Tx) error {
 		// 删除会话
 		sqlStr := "delete from t_session where id = ?"
@@ -75,22 +125,65 @@ func (c *Chat) DeleteSession(id string) (string, error) {
 			log.Error().Err(err).Msg("delete session chat error")
 			return err
 		}
+		// 删除标签
+		sqlStr = "delete from t_session_tag where session_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete session tag error")
+			return err
+		}
+		// 删除附件
+		sqlStr = "delete from t_chat_attachment where session_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete session attachment error")
+			return err
+		}
+		// 删除工具调用
+		sqlStr = "delete from t_chat_tool_call where session_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete session tool call error")
+			return err
+		}
+		// 删除全文索引
+		sqlStr = "delete from t_chat_message_fts where session_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete session chat index error")
+			return err
+		}
 		return nil
 	})
 }
 
 func (c *Chat) UpdateSession(session *SessionModel) (*SessionModel, error) {
 	session.UpdatedAt = session.CreatedAt
+	session.SessionName, session.NameSource = sessionName(session.SessionName)
+	if _, err := sessionResponseFormat(session); err != nil {
+		return nil, err
+	}
+	if err := checkSessionOptions(session); err != nil {
+		return nil, err
+	}
+	if _, err := sessionKnowledgeBases(session); err != nil {
+		return nil, err
+	}
 
-	sqlStr := `update t_session set session_name = ?, model_name = ?, message_history_count = ?, keep_alive = ?, system_message = ?, options = ?, updated_at = ?
+	// 会话名称被修改时更新名称来源
+	sqlStr := `update t_session set name_source = case when session_name = ? then name_source else ? end,
+               session_name = ?, model_name = ?, message_history_count = ?, keep_alive = ?, system_message = ?, options = ?, tools = ?,
+               summary_enabled = ?, summary_model_name = ?, response_format = ?, format_retries = ?, knowledge_bases = ?, updated_at = ?
                where id = ?`
-	_, err := dao.db().ExecContext(app.ctx, sqlStr, session.SessionName, session.ModelName,
-		session.MessageHistoryCount, session.KeepAlive, session.SystemMessage, session.Options, session.UpdatedAt, session.Id)
-	return session, err
+	_, err := dao.db().ExecContext(app.ctx, sqlStr, session.SessionName, session.NameSource, session.SessionName, session.ModelName,
+		session.MessageHistoryCount, session.KeepAlive, session.SystemMessage, session.Options, session.Tools,
+		session.SummaryEnabled, session.SummaryModelName, session.ResponseFormat, session.FormatRetries, session.KnowledgeBases,
+		session.UpdatedAt, session.Id)
+	if err != nil {
+		log.Error().Err(err).Msg("update session error")
+		return nil, err
+	}
+	return c.GetSession(session.Id)
 }
 
 func (c *Chat) GetSession(id string) (*SessionModel, error) {
-	sqlStr := `select id, session_name, model_name, message_history_count, keep_alive, system_message, options, created_at, updated_at
+	sqlStr := `select ` + sessionColumns + `
             from t_session
             where id = ?`
 	rows, err := dao.db().QueryContext(app.ctx, sqlStr, id)
@@ -103,8 +196,15 @@ func (c *Chat) GetSession(id string) (*SessionModel, error) {
 		session, err := c.scanSession(rows)
 		if err != nil {
 			log.Error().Err(err).Msg("fill session error")
+			return nil, err
 		}
-		return session, err
+		rows.Close()
+		tags, err := c.sessionTags([]string{session.Id})
+		if err != nil {
+			return nil, err
+		}
+		session.Tags = tags[session.Id]
+		return session, nil
 	}
 	return nil, errors.New("session not exists")
 }
@@ -116,14 +216,33 @@ type ChatMessage struct {
 	Content   string    `json:"content"`
 	Success   bool      `json:"success"`
 	CreatedAt time.Time `json:"createdAt"`
+
+	Images    []*ChatAttachmentModel `json:"images,omitempty"`
+	Documents []*ChatAttachmentModel `json:"documents,omitempty"`
+	ToolCalls []*ChatToolCallModel   `json:"toolCalls,omitempty"`
+	// 分支信息
+	ParentId string   `json:"parentId"`
+	Siblings []string `json:"siblings,omitempty"`
+	// 结构化输出
+	Structured      string `json:"structured,omitempty"`
+	StructuredError string `json:"structuredError,omitempty"`
+	// 回答状态
+	Status string `json:"status,omitempty"`
+	// 回答引用的知识库内容
+	Citations []*KnowledgeCitation `json:"citations,omitempty"`
 }
 
+const chatMessageColumns = `id, session_id, parent_id, question_content, answer_content, total_duration, load_duration,
+                 prompt_eval_count, prompt_eval_duration, eval_count, eval_duration, done_reason, is_success,
+                 structured_content, structured_error, status, citations, created_at, updated_at`
+
 func (c *Chat) scanChatMessage(rows *sql.Rows) (*ChatMessageModel, error) {
 	chatMessage := &ChatMessageModel{}
-	if err := rows.Scan(&chatMessage.Id, &chatMessage.SessionId, &chatMessage.QuestionContent, &chatMessage.AnswerContent,
+	if err := rows.Scan(&chatMessage.Id, &chatMessage.SessionId, &chatMessage.ParentId, &chatMessage.QuestionContent, &chatMessage.AnswerContent,
 		&chatMessage.TotalDuration, &chatMessage.LoadDuration, &chatMessage.PromptEvalCount,
 		&chatMessage.PromptEvalDuration, &chatMessage.EvalCount, &chatMessage.EvalDuration, &chatMessage.DoneReason,
-		&chatMessage.IsSuccess, &chatMessage.CreatedAt, &chatMessage.UpdatedAt); err != nil {
+		&chatMessage.IsSuccess, &chatMessage.StructuredContent, &chatMessage.StructuredError, &chatMessage.Status,
+		&chatMessage.Citations, &chatMessage.CreatedAt, &chatMessage.UpdatedAt); err != nil {
 		return nil, err
 	}
 	return chatMessage, nil
@@ -134,57 +253,46 @@ type SessionHistoryMessageRequest struct {
 	NextMarker string `json:"nextMarker"`
 }
 
+// SessionHistoryMessages 查询会话当前分支上的历史消息，NextMarker 为上一页最早的消息编号
 func (c *Chat) SessionHistoryMessages(request *SessionHistoryMessageRequest) ([]*ChatMessage, error) {
-	var timeMarker time.Time
-	if request.NextMarker != "" {
-		// 查询历史存在有效回答的消息
-		sqlStr := `select created_at from t_chat_message where session_id = ? and id = ?`
-		rows, err := dao.db().QueryContext(app.ctx, sqlStr, request.SessionId, request.NextMarker)
+	leafId, minDepth := request.NextMarker, 1
+	if leafId == "" {
+		session, err := c.GetSession(request.SessionId)
 		if err != nil {
-			log.Error().Err(err).Msg("query chat message with marker error")
+			log.Error().Err(err).Msg("get session error")
 			return nil, err
 		}
-		defer rows.Close()
-		if rows.Next() {
-			err := rows.Scan(&timeMarker)
-			if err != nil {
-				log.Error().Err(err).Msg("fill time marker error")
-				return nil, err
-			}
-		}
+		leafId, minDepth = session.ActiveMessageId, 0
 	}
-	if timeMarker.IsZero() {
-		timeMarker = time.Now()
+	if leafId == "" {
+		return nil, nil
 	}
 
-	sqlStr := `select id, session_id, question_content, answer_content, total_duration, load_duration, 
-                 prompt_eval_count, prompt_eval_duration, eval_count, eval_duration, done_reason, is_success, created_at, updated_at
-            from t_chat_message
-            where session_id = ? and created_at < ?
-            order by created_at desc
-            limit ?`
-	rows, err := dao.db().QueryContext(app.ctx, sqlStr, request.SessionId, timeMarker, 50)
+	chatMessages, err := c.pathMessages(leafId, minDepth, false, 50)
 	if err != nil {
-		log.Error().Err(err).Msg("query chat message error")
 		return nil, err
 	}
-	defer rows.Close()
-	var chatMessages []*ChatMessageModel
-	for rows.Next() {
-		item, err := c.scanChatMessage(rows)
-		if err != nil {
-			log.Error().Err(err).Msg("fill chat message error")
-			return nil, err
-		}
-		chatMessages = append(chatMessages, item)
-	}
 	if len(chatMessages) == 0 {
 		return nil, nil
 	}
+	ids := chatMessageIds(chatMessages)
+	attachments, err := c.chatAttachments(ids)
+	if err != nil {
+		return nil, err
+	}
+	toolCalls, err := c.chatToolCalls(ids)
+	if err != nil {
+		return nil, err
+	}
+	siblings, err := c.chatSiblings(request.SessionId, chatMessages)
+	if err != nil {
+		return nil, err
+	}
 
 	var messages []*ChatMessage
 	for i := len(chatMessages) - 1; i >= 0; i-- {
 		message := chatMessages[i]
+		images, documents := splitAttachments(attachments[message.Id])
 		messages = append(messages, &ChatMessage{
 			Id:        message.Id,
 			SessionId: message.SessionId,
@@ -192,6 +300,10 @@ func (c *Chat) SessionHistoryMessages(request *SessionHistoryMessageRequest) ([]
 			Content:   message.QuestionContent,
 			Success:   true,
 			CreatedAt: message.CreatedAt,
+			Images:    images,
+			Documents: documents,
+			ParentId:  message.ParentId,
+			Siblings:  siblings[message.ParentId],
 		})
 		// 回答
 		messages = append(messages, &ChatMessage{
@@ -201,21 +313,37 @@ func (c *Chat) SessionHistoryMessages(request *SessionHistoryMessageRequest) ([]
 			Content:   message.AnswerContent,
 			Success:   message.IsSuccess,
 			CreatedAt: message.CreatedAt,
+			ToolCalls: toolCalls[message.Id],
+			ParentId:  message.ParentId,
+			Siblings:  siblings[message.ParentId],
+
+			Structured:      message.StructuredContent,
+			StructuredError: message.StructuredError,
+			Status:          message.Status,
+			Citations:       messageCitations(message),
 		})
 	}
 	return messages, nil
 }
 
 type ConversationRequest struct {
-	SessionId string `json:"sessionId"`
-	Content   string `json:"content"`
+	SessionId string                 `json:"sessionId"`
+	Content   string                 `json:"content"`
+	Images    []*ChatAttachmentModel `json:"images"`
+	// 问题携带的文档，只需要文件名及文件内容，文档文本会加入问题中
+	Documents []*ChatAttachmentModel `json:"documents"`
 }
 
 type ConversationResponse struct {
-	Id        string    `json:"id"`
-	SessionId string    `json:"sessionId"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"createdAt"`
+	Id        string                 `json:"id"`
+	SessionId string                 `json:"sessionId"`
+	ParentId  string                 `json:"parentId"`
+	Content   string                 `json:"content"`
+	CreatedAt time.Time              `json:"createdAt"`
+	Images    []*ChatAttachmentModel `json:"images,omitempty"`
+	Documents []*ChatAttachmentModel `json:"documents,omitempty"`
+	// 问题前面等待回答的数量，为 0 时立即开始回答
+	QueuePosition int `json:"queuePosition"`
 }
 
 func (c *Chat) Conversation(request *ConversationRequest) (*ConversationResponse, error) {
@@ -224,40 +352,108 @@ func (c *Chat) Conversation(request *ConversationRequest) (*ConversationResponse
 		log.Error().Err(err).Msg("get session error")
 		return nil, err
 	}
+	return c.startConversation(session, session.ActiveMessageId, true, request.Content, request.Images, request.Documents)
+}
 
+// 在指定父消息下开始新一轮问答，问答加入会话队列依次进行
+// followActive 为 true 时在当前分支末尾追加，实际的父消息在开始回答时确定
+func (c *Chat) startConversation(session *SessionModel, parentId string, followActive bool, content string,
+	images, documents []*ChatAttachmentModel) (*ConversationResponse, error) {
 	message := &ChatMessageModel{
 		Id:              uuid.NewString(),
 		SessionId:       session.Id,
-		QuestionContent: request.Content,
+		ParentId:        parentId,
+		QuestionContent: content,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 	}
+	var err error
+	message.Images, err = c.prepareImages(session.Id, message.Id, images)
+	if err != nil {
+		log.Error().Err(err).Msg("prepare images error")
+		return nil, err
+	}
+	message.Documents, err = c.prepareDocuments(session.Id, message.Id, documents)
+	if err != nil {
+		return nil, err
+	}
 
-	go c.chat(session, message)
+	ctx, cancel := context.WithCancel(app.ctx)
+	c.addCancel(message.Id, cancel)
+	// 排队中的问题也可以通过 StreamState 查询
+	c.stream(message.Id)
+	position := c.enqueue(&chatQueueItem{
+		ctx:          ctx,
+		message:      message,
+		followActive: followActive,
+	})
 	return &ConversationResponse{
-		Id:        message.Id,
-		SessionId: message.SessionId,
-		Content:   message.QuestionContent,
-		CreatedAt: message.CreatedAt,
+		Id:            message.Id,
+		SessionId:     message.SessionId,
+		ParentId:      message.ParentId,
+		Content:       message.QuestionContent,
+		CreatedAt:     message.CreatedAt,
+		Images:        message.Images,
+		Documents:     message.Documents,
+		QueuePosition: position,
 	}, nil
 }
 
 func (c *Chat) createChatMessage(message *ChatMessageModel) error {
-	sqlStr := `insert into t_chat_message(id, session_id, question_content, answer_content, total_duration, load_duration, 
+	return dao.transaction(func(tx *sql.Tx) error {
+		if err := c.insertChatMessage(tx, message); err != nil {
+			return err
+		}
+		// 新消息成为当前分支
+		sqlStr := `update t_session set active_message_id = ? where id = ?`
+		if _, err := tx.ExecContext(app.ctx, sqlStr, message.Id, message.SessionId); err != nil {
+			log.Error().Err(err).Msg("update session active message error")
+			return err
+		}
+		return nil
+	})
+}
+
+// 保存消息及其附件、工具调用，并同步全文索引
+func (c *Chat) insertChatMessage(tx *sql.Tx, message *ChatMessageModel) error {
+	sqlStr := `insert into t_chat_message(id, session_id, parent_id, question_content, answer_content, total_duration, load_duration, 
                    prompt_eval_count, prompt_eval_duration, eval_count, eval_duration, done_reason,
-                   is_success, created_at, updated_at) 
-               values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	if _, err := dao.db().ExecContext(app.ctx, sqlStr, message.Id, message.SessionId, message.QuestionContent,
+                   is_success, structured_content, structured_error, status, citations, created_at, updated_at) 
+               values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := tx.ExecContext(app.ctx, sqlStr, message.Id, message.SessionId, message.ParentId, message.QuestionContent,
 		message.AnswerContent, message.TotalDuration, message.LoadDuration,
 		message.PromptEvalCount, message.PromptEvalDuration, message.EvalCount, message.EvalDuration, message.DoneReason,
-		message.IsSuccess, message.CreatedAt, message.UpdatedAt); err != nil {
+		message.IsSuccess, message.StructuredContent, message.StructuredError, message.Status,
+		message.Citations, message.CreatedAt, message.UpdatedAt); err != nil {
 		log.Error().Err(err).Msg("create chat message error")
 		return err
 	}
-	return nil
+	// 同步全文索引
+	sqlStr = `insert into t_chat_message_fts(message_id, session_id, question_content, answer_content) values(?, ?, ?, ?)`
+	if _, err := tx.ExecContext(app.ctx, sqlStr, message.Id, message.SessionId, message.QuestionContent, message.AnswerContent); err != nil {
+		log.Error().Err(err).Msg("create chat message index error")
+		return err
+	}
+	if err := c.createChatAttachments(tx, message.Images); err != nil {
+		return err
+	}
+	if err := c.createChatAttachments(tx, message.Documents); err != nil {
+		return err
+	}
+	return c.createChatToolCalls(tx, message.ToolCalls)
+}
+
+func chatMessageIds(messages []*ChatMessageModel) []string {
+	ids := make([]string, len(messages))
+	for i, message := range messages {
+		ids[i] = message.Id
+	}
+	return ids
 }
 
-func (c *Chat) combineHistoryMessages(session *SessionModel) ([]olm.Message, error) {
+// 组装历史消息，在会话历史轮数限制内按上下文 token 预算选取最近的问答，超出预算的消息会被丢弃并通知
+// 启用历史摘要时摘要紧跟系统消息，摘要已包含的问答不再重复加入
+func (c *Chat) combineHistoryMessages(session *SessionModel, message *ChatMessageModel, contextLength, budget int) ([]olm.Message, error) {
 	var ollamaMessages []olm.Message
 	if session.SystemMessage != "" {
 		ollamaMessages = append(ollamaMessages, olm.Message{
@@ -266,73 +462,147 @@ func (c *Chat) combineHistoryMessages(session *SessionModel) ([]olm.Message, err
 			Images:  nil,
 		})
 	}
-	if session.MessageHistoryCount < 1 {
+	useSummary, err := c.usableSummary(session, message.ParentId)
+	if err != nil {
+		return nil, err
+	}
+	if useSummary {
+		content := summaryMessagePrefix + session.Summary
+		ollamaMessages = append(ollamaMessages, olm.Message{
+			Role:    messageRoleSystem,
+			Content: content,
+			Images:  nil,
+		})
+		budget -= estimateTokens(content)
+	}
+	if session.MessageHistoryCount < 1 || message.ParentId == "" {
 		return ollamaMessages, nil
 	}
-	sqlStr := `select id, session_id, question_content, answer_content, total_duration, load_duration, 
-                 prompt_eval_count, prompt_eval_duration, eval_count, eval_duration, done_reason,
-                 is_success, created_at, updated_at
-            from t_chat_message
-            where session_id = ? and is_success = 1
-            order by created_at desc
-            limit ?`
-	rows, err := dao.db().QueryContext(app.ctx, sqlStr, session.Id, session.MessageHistoryCount)
+	messages, err := c.pathMessages(message.ParentId, 0, true, session.MessageHistoryCount)
 	if err != nil {
-		log.Error().Err(err).Msg("query history chat message error")
 		return nil, err
 	}
-	defer rows.Close()
-	var messages []*ChatMessageModel
-	for rows.Next() {
-		message, err := c.scanChatMessage(rows)
-		if err != nil {
-			log.Error().Err(err).Msg("fill chat message error")
-			return nil, err
+	if useSummary {
+		for i, history := range messages {
+			if history.Id == session.SummaryMessageId {
+				messages = messages[:i]
+				break
+			}
 		}
-		messages = append(messages, message)
 	}
 	if len(messages) == 0 {
-		return nil, nil
+		return ollamaMessages, nil
+	}
+	attachments, err := c.chatAttachments(chatMessageIds(messages))
+	if err != nil {
+		return nil, err
+	}
+	fitted, questions, used := fitHistoryMessages(messages, attachments, budget)
+	if len(fitted) < len(messages) {
+		c.emitHistoryTrimmed(&HistoryTrimmed{
+			SessionId:         session.Id,
+			MessageId:         message.Id,
+			ContextLength:     contextLength,
+			Budget:            budget,
+			UsedTokens:        used,
+			IncludedCount:     len(fitted),
+			DroppedCount:      len(messages) - len(fitted),
+			DroppedMessageIds: chatMessageIds(messages[len(fitted):]),
+		})
+		messages = fitted
 	}
 
 	for i := len(messages) - 1; i >= 0; i-- {
-		message := messages[i]
-		// 问题
+		history := messages[i]
+		// 问题，携带文档时包含文档内容
 		ollamaMessages = append(ollamaMessages, olm.Message{
 			Role:    messageRoleUser,
-			Content: message.QuestionContent,
-			Images:  nil,
+			Content: questions[i],
+			Images:  imageData(attachments[history.Id]),
 		})
 		// 回答
 		ollamaMessages = append(ollamaMessages, olm.Message{
 			Role:    messageRoleAssistant,
-			Content: message.AnswerContent,
+			Content: history.AnswerContent,
 			Images:  nil,
 		})
 	}
 	return ollamaMessages, nil
 }
 
+func (c *Chat) addCancel(messageId string, cancel context.CancelFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cancels == nil {
+		c.cancels = make(map[string]context.CancelFunc)
+	}
+	c.cancels[messageId] = cancel
+}
+
+func (c *Chat) removeCancel(messageId string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cancel, ok := c.cancels[messageId]; ok {
+		cancel()
+		delete(c.cancels, messageId)
+	}
+}
+
+// StopConversation 停止正在进行中的回答，问题仍在排队时直接移出队列
+func (c *Chat) StopConversation(messageId string) {
+	if c.removeQueued(messageId) {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cancel, ok := c.cancels[messageId]; ok {
+		cancel()
+	}
+}
+
+// 回答被取消时保存已生成的部分回答，没有生成内容时视为失败，不作为历史消息
+func (c *Chat) emitChatCanceled(message *ChatMessageModel, content string) {
+	message.IsSuccess = content != ""
+	message.DoneReason = doneReasonCanceled
+	message.UpdatedAt = time.Now()
+	message.AnswerContent = content
+	c.stream(message.Id).finish(content, message.IsSuccess)
+}
+
+// 回答出错，出错原因为回答被取消时按取消处理
+func (c *Chat) emitChatFailed(ctx context.Context, message *ChatMessageModel, content string, err error) {
+	if ctx.Err() != nil {
+		c.emitChatCanceled(message, content)
+	} else {
+		c.emitChatError(message, err)
+	}
+}
+
 func (c *Chat) emitChatError(message *ChatMessageModel, err error) {
 	message.IsSuccess = false
 	message.DoneReason = err.Error()
 	message.UpdatedAt = time.Now()
 	message.AnswerContent = err.Error()
-	runtime.EventsEmit(app.ctx, message.Id, err.Error(), true, false)
+	c.stream(message.Id).finish(err.Error(), false)
 }
 
-func (c *Chat) chat(session *SessionModel, message *ChatMessageModel) {
-	defer c.createChatMessage(message)
-	messages, err := c.combineHistoryMessages(session)
+func (c *Chat) chat(ctx context.Context, session *SessionModel, message *ChatMessageModel) {
+	defer c.removeCancel(message.Id)
+	defer c.removeStream(message.Id)
+	// 先保存问题，回答过程中定期保存已生成的内容，避免程序异常退出时丢失
+	message.Status = messageStatusRunning
+	if err := c.createChatMessage(message); err != nil {
+		c.emitChatError(message, err)
+		return
+	}
+	defer c.summarize(session, message)
+	defer c.generateSessionName(session, message)
+	defer c.finishChatMessage(message)
+	options, err := sessionOptions(session)
 	if err != nil {
 		c.emitChatError(message, err)
 		return
 	}
-	messages = append(messages, olm.Message{
-		Role:    messageRoleUser,
-		Content: message.QuestionContent,
-		Images:  nil,
-	})
 	var keepAlive *olm.Duration
 	if session.KeepAlive != "" {
 		duration, err := time.ParseDuration(session.KeepAlive)
@@ -344,68 +614,148 @@ func (c *Chat) chat(session *SessionModel, message *ChatMessageModel) {
 			Duration: duration,
 		}
 	}
-	var options map[string]interface{}
-	if session.Options != "" {
-		var sessionOptions map[string]string
-		if err := json.Unmarshal([]byte(session.Options), &sessionOptions); err != nil {
-			c.emitChatError(message, err)
-			return
-		}
-		options = make(map[string]interface{})
-		for name, value := range sessionOptions {
-			if value == "" {
-				continue
-			}
-			switch name {
-			case "seed":
-				options["seed"], _ = strconv.Atoi(value)
-			case "numPredict":
-				options["num_predict"], _ = strconv.Atoi(value)
-			case "topK":
-				options["top_k"], _ = strconv.Atoi(value)
-			case "topP":
-				options["top_p"], _ = strconv.ParseFloat(value, 32)
-			case "numCtx":
-				options["num_ctx"], _ = strconv.Atoi(value)
-			case "temperature":
-				options["temperature"], _ = strconv.ParseFloat(value, 32)
-			case "repeatPenalty":
-				options["repeat_penalty"], _ = strconv.ParseFloat(value, 32)
-			}
-		}
+	toolNames, err := sessionTools(session)
+	if err != nil {
+		c.emitChatError(message, err)
+		return
+	}
+	tools := toolRegistry.definitions(toolNames)
+	format, err := sessionResponseFormat(session)
+	if err != nil {
+		c.emitChatError(message, err)
+		return
 	}
 
-	var buffer bytes.Buffer
+	contextLength := c.contextLength(session.ModelName, options)
+	// 问题携带文档时加入文档内容，文档最多占用一半上下文
+	question := documentQuestion(message.QuestionContent, message.Documents, contextLength/2)
+	// 关联知识库时在问题前加入检索到的参考资料
+	question, err = c.knowledgeQuestion(ctx, session, message, question)
+	if err != nil {
+		c.emitChatFailed(ctx, message, "", err)
+		return
+	}
+	budget := c.historyBudget(contextLength, session, message, options, tools)
+	budget = budget - estimateTokens(question) + estimateTokens(message.QuestionContent)
+	if budget < 0 {
+		budget = 0
+	}
+	messages, err := c.combineHistoryMessages(session, message, contextLength, budget)
+	if err != nil {
+		c.emitChatFailed(ctx, message, "", err)
+		return
+	}
+	messages = append(messages, olm.Message{
+		Role:    messageRoleUser,
+		Content: question,
+		Images:  imageData(message.Images),
+	})
 
 	request := &olm.ChatRequest{
 		Model:     session.ModelName,
 		Messages:  messages,
 		KeepAlive: keepAlive,
+		Tools:     tools,
 		Options:   options,
 	}
-	log.Debug().Any("request", request).Msg("chat request")
-
-	err = ollama.newApiClient().Chat(app.ctx, request, func(response olm.ChatResponse) error {
-		respMessage := response.Message
-		buffer.WriteString(respMessage.Content)
-		fullContent := buffer.String()
-		if response.Done {
-			message.UpdatedAt = response.CreatedAt
-			message.IsSuccess = true
-			message.AnswerContent = fullContent
-			message.DoneReason = response.DoneReason
-			metrics := response.Metrics
-			message.TotalDuration = metrics.TotalDuration
-			message.LoadDuration = metrics.LoadDuration
-			message.PromptEvalCount = metrics.PromptEvalCount
-			message.PromptEvalDuration = metrics.PromptEvalDuration
-			message.EvalCount = metrics.EvalCount
-			message.EvalDuration = metrics.EvalDuration
+	if format != nil {
+		request.Format = format.raw
+	}
+
+	stream := c.stream(message.Id)
+	// 已生成的回答内容，回答被取消时保存
+	var answer string
+	// 结构化回答校验失败后已重试的次数
+	retries := 0
+	lastCheckpoint := time.Now()
+	// 模型请求调用工具时执行工具并将结果回传给模型，直到模型给出最终回答
+	for round := 0; ; round++ {
+		log.Debug().Any("request", request).Msg("chat request")
+
+		var buffer bytes.Buffer
+		var toolCalls []olm.ToolCall
+		var invalid error
+		// 新一轮回答的内容替换上一轮的内容
+		replace := round > 0
+		err = ollama.newApiClient().Chat(ctx, request, func(response olm.ChatResponse) error {
+			respMessage := response.Message
+			buffer.WriteString(respMessage.Content)
+			toolCalls = append(toolCalls, respMessage.ToolCalls...)
+			fullContent := buffer.String()
+			if fullContent != "" {
+				answer = fullContent
+			}
+			if response.Done {
+				metrics := response.Metrics
+				message.TotalDuration += metrics.TotalDuration
+				message.LoadDuration += metrics.LoadDuration
+				message.PromptEvalCount = metrics.PromptEvalCount
+				message.PromptEvalDuration += metrics.PromptEvalDuration
+				message.EvalCount += metrics.EvalCount
+				message.EvalDuration += metrics.EvalDuration
+			}
+			done := response.Done && len(toolCalls) == 0
+			if done && format != nil {
+				// 校验失败且可以重试时继续等待新的回答
+				if invalid = format.validate(message, fullContent); invalid != nil && retries < session.FormatRetries {
+					done = false
+				}
+			}
+			if done {
+				message.UpdatedAt = response.CreatedAt
+				message.IsSuccess = true
+				message.AnswerContent = fullContent
+				message.DoneReason = response.DoneReason
+			}
+			if !done && time.Since(lastCheckpoint) >= checkpointInterval {
+				c.checkpoint(message, answer)
+				lastCheckpoint = time.Now()
+			}
+			if done {
+				stream.finish(fullContent, true)
+			} else if respMessage.Content != "" {
+				if replace {
+					stream.replace(fullContent)
+					replace = false
+				} else {
+					stream.append(respMessage.Content)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.emitChatFailed(ctx, message, answer, err)
+			return
+		}
+		if len(toolCalls) == 0 {
+			if invalid == nil || retries >= session.FormatRetries {
+				return
+			}
+			retries++
+			request.Messages = append(request.Messages, olm.Message{
+				Role:    messageRoleAssistant,
+				Content: buffer.String(),
+			}, olm.Message{
+				Role:    messageRoleUser,
+				Content: fmt.Sprintf(formatRetryPrompt, invalid.Error()),
+			})
+			continue
+		}
+		if round >= maxToolRounds-1 {
+			c.emitChatError(message, errors.New("too many tool call rounds"))
+			return
+		}
+		request.Messages = append(request.Messages, olm.Message{
+			Role:      messageRoleAssistant,
+			Content:   buffer.String(),
+			ToolCalls: toolCalls,
+		})
+		for _, toolCall := range toolCalls {
+			toolCallModel := c.callTool(ctx, message, round, toolCall)
+			request.Messages = append(request.Messages, olm.Message{
+				Role:    messageRoleTool,
+				Content: toolCallModel.Result,
+			})
 		}
-		runtime.EventsEmit(app.ctx, message.Id, fullContent, response.Done, true)
-		return nil
-	})
-	if err != nil {
-		c.emitChatError(message, err)
 	}
 }
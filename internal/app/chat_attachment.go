@@ -0,0 +1,102 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"strings"
+	"time"
+)
+
+// 单张图片最大尺寸
+const maxImageSize = 20 * 1024 * 1024
+
+var errInvalidImage = errors.New("attachment is not a valid image")
+
+// 校验并补全问题中携带的图片信息
+func (c *Chat) prepareImages(sessionId, messageId string, images []*ChatAttachmentModel) ([]*ChatAttachmentModel, error) {
+	var attachments []*ChatAttachmentModel
+	for _, image := range images {
+		if image == nil || len(image.Content) == 0 {
+			continue
+		}
+		if len(image.Content) > maxImageSize {
+			return nil, errors.New("image size exceeds 20MB")
+		}
+		mimeType := http.DetectContentType(image.Content)
+		if !strings.HasPrefix(mimeType, "image/") {
+			return nil, errInvalidImage
+		}
+		attachments = append(attachments, &ChatAttachmentModel{
+			Id:             uuid.NewString(),
+			SessionId:      sessionId,
+			MessageId:      messageId,
+			AttachmentType: attachmentTypeImage,
+			FileName:       image.FileName,
+			MimeType:       mimeType,
+			Content:        image.Content,
+			CreatedAt:      time.Now(),
+		})
+	}
+	return attachments, nil
+}
+
+func (c *Chat) createChatAttachments(tx *sql.Tx, attachments []*ChatAttachmentModel) error {
+	sqlStr := `insert into t_chat_attachment(id, session_id, message_id, attachment_type, file_name, mime_type, content, created_at)
+               values(?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, attachment := range attachments {
+		if _, err := tx.ExecContext(app.ctx, sqlStr, attachment.Id, attachment.SessionId, attachment.MessageId,
+			attachment.AttachmentType, attachment.FileName, attachment.MimeType, attachment.Content, attachment.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("create chat attachment error")
+			return err
+		}
+	}
+	return nil
+}
+
+// 查询消息关联的附件，以消息编号分组
+func (c *Chat) chatAttachments(messageIds []string) (map[string][]*ChatAttachmentModel, error) {
+	attachments := make(map[string][]*ChatAttachmentModel)
+	if len(messageIds) == 0 {
+		return attachments, nil
+	}
+	args := make([]interface{}, len(messageIds))
+	for i, id := range messageIds {
+		args[i] = id
+	}
+	sqlStr := `select id, session_id, message_id, attachment_type, file_name, mime_type, content, created_at
+            from t_chat_attachment
+            where message_id in (?` + strings.Repeat(", ?", len(messageIds)-1) + `)
+            order by created_at`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("query chat attachment error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		attachment := &ChatAttachmentModel{}
+		if err := rows.Scan(&attachment.Id, &attachment.SessionId, &attachment.MessageId, &attachment.AttachmentType,
+			&attachment.FileName, &attachment.MimeType, &attachment.Content, &attachment.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("fill chat attachment error")
+			return nil, err
+		}
+		attachment.stored = true
+		attachments[attachment.MessageId] = append(attachments[attachment.MessageId], attachment)
+	}
+	return attachments, nil
+}
+
+// 提取附件中的图片数据
+func imageData(attachments []*ChatAttachmentModel) []olm.ImageData {
+	var images []olm.ImageData
+	for _, attachment := range attachments {
+		if attachment.AttachmentType == attachmentTypeImage {
+			images = append(images, attachment.Content)
+		}
+	}
+	return images
+}
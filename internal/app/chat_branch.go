@@ -0,0 +1,187 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"ollama-desktop/internal/log"
+	"strings"
+	"time"
+)
+
+// 查询从指定消息沿父消息向上追溯的消息路径，按从新到旧排序
+// minDepth 为跳过的层级，onlySuccess 为是否只查询成功的问答
+func (c *Chat) pathMessages(leafId string, minDepth int, onlySuccess bool, limit int) ([]*ChatMessageModel, error) {
+	sqlStr := `with recursive path(id, depth) as (
+                select id, 0 from t_chat_message where id = ?
+                union all
+                select m.parent_id, p.depth + 1 from t_chat_message m join path p on m.id = p.id where m.parent_id != ''
+            )
+            select ` + prefixColumns("m", chatMessageColumns) + `
+            from path p join t_chat_message m on m.id = p.id
+            where p.depth >= ?`
+	if onlySuccess {
+		sqlStr += ` and m.is_success = 1`
+	}
+	sqlStr += `
+            order by p.depth
+            limit ?`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, leafId, minDepth, limit)
+	if err != nil {
+		log.Error().Err(err).Msg("query path chat message error")
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []*ChatMessageModel
+	for rows.Next() {
+		message, err := c.scanChatMessage(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill chat message error")
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, nil
+}
+
+// 检查消息是否位于从指定消息向上追溯的路径上
+func (c *Chat) onPath(leafId, messageId string) (bool, error) {
+	sqlStr := `with recursive path(id) as (
+                select id from t_chat_message where id = ?
+                union all
+                select m.parent_id from t_chat_message m join path p on m.id = p.id where m.parent_id != ''
+            )
+            select count(1) from path where id = ?`
+	var count int
+	if err := dao.db().QueryRowContext(app.ctx, sqlStr, leafId, messageId).Scan(&count); err != nil {
+		log.Error().Err(err).Msg("query chat message path error")
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// 为字段列表添加表别名
+func prefixColumns(alias, columns string) string {
+	fields := strings.Split(columns, ",")
+	for i, field := range fields {
+		fields[i] = alias + "." + strings.TrimSpace(field)
+	}
+	return strings.Join(fields, ", ")
+}
+
+// 查询消息的同级分支，以父消息编号分组，按创建时间排序
+func (c *Chat) chatSiblings(sessionId string, messages []*ChatMessageModel) (map[string][]string, error) {
+	siblings := make(map[string][]string)
+	if len(messages) == 0 {
+		return siblings, nil
+	}
+	args := []interface{}{sessionId}
+	for _, message := range messages {
+		args = append(args, message.ParentId)
+	}
+	sqlStr := `select id, parent_id from t_chat_message
+            where session_id = ? and parent_id in (?` + strings.Repeat(", ?", len(messages)-1) + `)
+            order by created_at`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("query chat siblings error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, parentId string
+		if err := rows.Scan(&id, &parentId); err != nil {
+			log.Error().Err(err).Msg("fill chat siblings error")
+			return nil, err
+		}
+		siblings[parentId] = append(siblings[parentId], id)
+	}
+	return siblings, nil
+}
+
+func (c *Chat) getChatMessage(id string) (*ChatMessageModel, error) {
+	sqlStr := `select ` + chatMessageColumns + `
+            from t_chat_message
+            where id = ?`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, id)
+	if err != nil {
+		log.Error().Err(err).Msg("query chat message error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		message, err := c.scanChatMessage(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill chat message error")
+		}
+		return message, err
+	}
+	return nil, errors.New("chat message not exists")
+}
+
+// RegenerateAnswer 对指定消息的问题重新生成回答，新回答作为原消息的同级分支
+func (c *Chat) RegenerateAnswer(messageId string) (*ConversationResponse, error) {
+	original, err := c.getChatMessage(messageId)
+	if err != nil {
+		return nil, err
+	}
+	session, err := c.GetSession(original.SessionId)
+	if err != nil {
+		log.Error().Err(err).Msg("get session error")
+		return nil, err
+	}
+	attachments, err := c.chatAttachments([]string{original.Id})
+	if err != nil {
+		return nil, err
+	}
+	images, documents := splitAttachments(attachments[original.Id])
+	return c.startConversation(session, original.ParentId, false, original.QuestionContent, images, documents)
+}
+
+type EditQuestionRequest struct {
+	MessageId string                 `json:"messageId"`
+	Content   string                 `json:"content"`
+	Images    []*ChatAttachmentModel `json:"images"`
+	Documents []*ChatAttachmentModel `json:"documents"`
+}
+
+// EditQuestion 修改指定消息的问题并重新发送，修改后的问答作为原消息的同级分支
+func (c *Chat) EditQuestion(request *EditQuestionRequest) (*ConversationResponse, error) {
+	original, err := c.getChatMessage(request.MessageId)
+	if err != nil {
+		return nil, err
+	}
+	session, err := c.GetSession(original.SessionId)
+	if err != nil {
+		log.Error().Err(err).Msg("get session error")
+		return nil, err
+	}
+	return c.startConversation(session, original.ParentId, false, request.Content, request.Images, request.Documents)
+}
+
+// SwitchBranch 切换到指定消息所在的分支，沿最新的子消息向下找到分支的最后一轮消息作为当前分支
+func (c *Chat) SwitchBranch(messageId string) (string, error) {
+	message, err := c.getChatMessage(messageId)
+	if err != nil {
+		return "", err
+	}
+	leafId := message.Id
+	sqlStr := `select id from t_chat_message where parent_id = ? order by created_at desc limit 1`
+	for {
+		var childId string
+		err := dao.db().QueryRowContext(app.ctx, sqlStr, leafId).Scan(&childId)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("query child chat message error")
+			return "", err
+		}
+		leafId = childId
+	}
+	sqlStr = `update t_session set active_message_id = ?, updated_at = ? where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, leafId, time.Now(), message.SessionId); err != nil {
+		log.Error().Err(err).Msg("update session active message error")
+		return "", err
+	}
+	return leafId, nil
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"database/sql"
+	"ollama-desktop/internal/log"
+	"time"
+)
+
+const (
+	messageStatusRunning     = "running"
+	messageStatusDone        = "done"
+	messageStatusInterrupted = "interrupted"
+
+	// 回答过程中保存已生成内容的间隔
+	checkpointInterval = 2 * time.Second
+)
+
+// 保存已生成的部分回答，程序异常退出时可以保留
+func (c *Chat) checkpoint(message *ChatMessageModel, content string) {
+	sqlStr := `update t_chat_message set answer_content = ?, updated_at = ? where id = ? and status = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, content, time.Now(), message.Id, messageStatusRunning); err != nil {
+		log.Error().Err(err).Msg("checkpoint chat message error")
+	}
+}
+
+// 回答结束后保存完整回答及工具调用，并同步全文索引
+func (c *Chat) finishChatMessage(message *ChatMessageModel) error {
+	message.Status = messageStatusDone
+	return dao.transaction(func(tx *sql.Tx) error {
+		sqlStr := `update t_chat_message set answer_content = ?, total_duration = ?, load_duration = ?, prompt_eval_count = ?,
+                       prompt_eval_duration = ?, eval_count = ?, eval_duration = ?, done_reason = ?, is_success = ?,
+                       structured_content = ?, structured_error = ?, status = ?, citations = ?, updated_at = ?
+                   where id = ?`
+		if _, err := tx.ExecContext(app.ctx, sqlStr, message.AnswerContent, message.TotalDuration, message.LoadDuration,
+			message.PromptEvalCount, message.PromptEvalDuration, message.EvalCount, message.EvalDuration, message.DoneReason,
+			message.IsSuccess, message.StructuredContent, message.StructuredError, message.Status, message.Citations,
+			message.UpdatedAt, message.Id); err != nil {
+			log.Error().Err(err).Msg("update chat message error")
+			return err
+		}
+		sqlStr = `update t_chat_message_fts set answer_content = ? where message_id = ?`
+		if _, err := tx.ExecContext(app.ctx, sqlStr, message.AnswerContent, message.Id); err != nil {
+			log.Error().Err(err).Msg("update chat message index error")
+			return err
+		}
+		return c.createChatToolCalls(tx, message.ToolCalls)
+	})
+}
+
+// 将上次运行时未结束的回答标记为中断，已保存的部分回答作为成功的回答保留
+func (c *Chat) interruptRunningMessages() error {
+	return dao.transaction(func(tx *sql.Tx) error {
+		sqlStr := `update t_chat_message_fts
+               set answer_content = (select m.answer_content from t_chat_message m where m.id = message_id)
+               where message_id in (select id from t_chat_message where status = ?)`
+		if _, err := tx.ExecContext(app.ctx, sqlStr, messageStatusRunning); err != nil {
+			log.Error().Err(err).Msg("update interrupted chat message index error")
+			return err
+		}
+		sqlStr = `update t_chat_message set status = ?, done_reason = ?, is_success = answer_content != ''
+               where status = ?`
+		result, err := tx.ExecContext(app.ctx, sqlStr, messageStatusInterrupted, messageStatusInterrupted, messageStatusRunning)
+		if err != nil {
+			log.Error().Err(err).Msg("interrupt running chat message error")
+			return err
+		}
+		if count, err := result.RowsAffected(); err == nil && count > 0 {
+			log.Info().Int64("count", count).Msg("interrupt running chat message")
+		}
+		return nil
+	})
+}
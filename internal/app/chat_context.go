@@ -0,0 +1,175 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"strconv"
+	"strings"
+)
+
+const (
+	eventChatHistoryTrimmed = "chat_history_trimmed"
+
+	// ollama 未指定 num_ctx 时使用的上下文长度
+	defaultNumCtx = 2048
+	// 未指定 num_predict 时为回答预留的 token 数量
+	defaultAnswerReserve = 512
+	// 单张图片占用的 token 估算值
+	imageTokenEstimate = 768
+	// 每条消息模板占用的 token 估算值
+	messageTokenOverhead = 4
+)
+
+// HistoryTrimmed 历史消息因超出上下文预算被丢弃的信息
+type HistoryTrimmed struct {
+	SessionId string `json:"sessionId"`
+	MessageId string `json:"messageId"`
+	// 上下文长度
+	ContextLength int `json:"contextLength"`
+	// 可用于历史消息的 token 数量
+	Budget int `json:"budget"`
+	// 已纳入的历史消息占用的 token 数量
+	UsedTokens    int `json:"usedTokens"`
+	IncludedCount int `json:"includedCount"`
+	DroppedCount  int `json:"droppedCount"`
+	// 被丢弃的消息编号，按从新到旧排序
+	DroppedMessageIds []string `json:"droppedMessageIds"`
+}
+
+// 计算可用于历史消息的 token 预算，上下文长度扣除系统消息、当前问题、工具定义以及回答预留部分
+func (c *Chat) historyBudget(contextLength int, session *SessionModel, message *ChatMessageModel, options map[string]interface{}, tools olm.Tools) int {
+	reserve := defaultAnswerReserve
+	if numPredict, ok := intOption(options, "num_predict"); ok && numPredict > 0 {
+		reserve = numPredict
+	}
+	// 预留部分最多占用一半上下文，避免历史消息完全无法纳入
+	if reserve > contextLength/2 {
+		reserve = contextLength / 2
+	}
+	budget := contextLength - reserve - questionTokens(message, len(message.Images))
+	if session.SystemMessage != "" {
+		budget -= estimateTokens(session.SystemMessage)
+	}
+	if len(tools) > 0 {
+		if data, err := json.Marshal(tools); err == nil {
+			budget -= estimateTokens(string(data))
+		}
+	}
+	if budget < 0 {
+		return 0
+	}
+	return budget
+}
+
+// 获取会话实际使用的上下文长度
+// 优先使用会话参数 num_ctx，其次为模型文件中的 num_ctx 参数，最后为 ollama 默认值，且不超过模型支持的最大上下文长度
+func (c *Chat) contextLength(modelName string, options map[string]interface{}) int {
+	contextLength := 0
+	if numCtx, ok := intOption(options, "num_ctx"); ok && numCtx > 0 {
+		contextLength = numCtx
+	}
+	resp, err := ollama.newApiClient().Show(app.ctx, &olm.ShowRequest{Model: modelName})
+	if err != nil {
+		log.Error().Err(err).Str("model", modelName).Msg("show ollama model error")
+	}
+	if contextLength == 0 && resp != nil {
+		contextLength = modelNumCtx(resp.Parameters)
+	}
+	if contextLength == 0 {
+		contextLength = defaultNumCtx
+	}
+	if resp != nil {
+		if maxLength := modelContextLength(resp.ModelInfo); maxLength > 0 && contextLength > maxLength {
+			contextLength = maxLength
+		}
+	}
+	return contextLength
+}
+
+// 解析模型文件参数中的 num_ctx，参数格式为每行一个“名称 值”
+func modelNumCtx(parameters string) int {
+	for _, line := range strings.Split(parameters, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "num_ctx" {
+			if numCtx, err := strconv.Atoi(fields[1]); err == nil {
+				return numCtx
+			}
+		}
+	}
+	return 0
+}
+
+// 模型支持的最大上下文长度，对应模型信息中的 <架构>.context_length
+func modelContextLength(modelInfo map[string]any) int {
+	for key, value := range modelInfo {
+		if !strings.HasSuffix(key, ".context_length") {
+			continue
+		}
+		if length, ok := value.(float64); ok {
+			return int(length)
+		}
+	}
+	return 0
+}
+
+// 按预算从新到旧选取历史消息，遇到无法纳入的消息时丢弃其及更早的消息，保证历史连续
+// 历史问题携带的文档重新加入问题，文档合计最多占用一半预算，越新的问题分配的额度越多，超出时截断
+// 返回选取的消息、与消息对应的问题内容及占用的 token 数量
+func fitHistoryMessages(messages []*ChatMessageModel, attachments map[string][]*ChatAttachmentModel, budget int) ([]*ChatMessageModel, []string, int) {
+	used := 0
+	documentBudget := budget / 2
+	questions := make([]string, 0, len(messages))
+	for i, message := range messages {
+		images, documents := splitAttachments(attachments[message.Id])
+		documentTokens := 0
+		for _, doc := range documents {
+			documentTokens += estimateTokens(string(doc.Content))
+		}
+		if documentTokens > documentBudget {
+			documentTokens = documentBudget
+		}
+		question := documentQuestion(message.QuestionContent, documents, documentTokens)
+		tokens := estimateTokens(question) + len(images)*imageTokenEstimate + answerTokens(message)
+		if used+tokens > budget {
+			return messages[:i], questions, used
+		}
+		used += tokens
+		documentBudget -= documentTokens
+		questions = append(questions, question)
+	}
+	return messages, questions, used
+}
+
+// 问题占用的 token 数量
+// 提问的 prompt_eval_count 包含了完整提示词且受 ollama 提示词缓存影响，无法反映单个问题的长度，因此使用估算值
+func questionTokens(message *ChatMessageModel, imageCount int) int {
+	return estimateTokens(message.QuestionContent) + imageCount*imageTokenEstimate
+}
+
+// 回答占用的 token 数量，优先使用模型返回的 eval_count
+func answerTokens(message *ChatMessageModel) int {
+	if message.EvalCount > 0 {
+		return message.EvalCount + messageTokenOverhead
+	}
+	return estimateTokens(message.AnswerContent)
+}
+
+// 估算文本的 token 数量，英文约四个字符一个 token，其他字符按一个字符一个 token 计算
+func estimateTokens(text string) int {
+	ascii, other := 0, 0
+	for _, r := range text {
+		if r < 0x80 {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other + messageTokenOverhead
+}
+
+func (c *Chat) emitHistoryTrimmed(trimmed *HistoryTrimmed) {
+	log.Info().Any("trimmed", trimmed).Msg("chat history trimmed")
+	runtime.EventsEmit(app.ctx, eventChatHistoryTrimmed, trimmed)
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFitHistoryMessages(t *testing.T) {
+	messages := []*ChatMessageModel{
+		{Id: "3", QuestionContent: "abcd", EvalCount: 10},
+		{Id: "2", QuestionContent: "abcd", EvalCount: 10},
+		{Id: "1", QuestionContent: "abcd", AnswerContent: "abcd"},
+	}
+	// 问题 1+4，回答 10+4
+	fitted, _, used := fitHistoryMessages(messages, nil, 40)
+	if len(fitted) != 2 || used != 38 {
+		t.Errorf("expected 2 messages and 38 tokens, got %d and %d", len(fitted), used)
+	}
+	fitted, _, _ = fitHistoryMessages(messages, map[string][]*ChatAttachmentModel{"3": {{}}}, 40)
+	if len(fitted) != 0 {
+		t.Errorf("expected no message, got %d", len(fitted))
+	}
+	fitted, _, used = fitHistoryMessages(messages, nil, 1000)
+	if len(fitted) != 3 || used != 48 {
+		t.Errorf("expected 3 messages and 48 tokens, got %d and %d", len(fitted), used)
+	}
+}
+
+func TestFitHistoryDocuments(t *testing.T) {
+	messages := []*ChatMessageModel{
+		{Id: "2", QuestionContent: "new", AnswerContent: "answer"},
+		{Id: "1", QuestionContent: "old", AnswerContent: "answer"},
+	}
+	attachments := map[string][]*ChatAttachmentModel{
+		"2": {{AttachmentType: attachmentTypeDocument, FileName: "new.txt", Content: []byte(strings.Repeat("新", 800))}},
+		"1": {{AttachmentType: attachmentTypeDocument, FileName: "old.txt", Content: []byte("short")}},
+	}
+	fitted, questions, used := fitHistoryMessages(messages, attachments, 1000)
+	if len(fitted) != 2 || len(questions) != 2 || used > 1000 {
+		t.Fatalf("unexpected fitted %d questions %d used %d", len(fitted), len(questions), used)
+	}
+	// 较新的文档占满一半预算后被截断，较早的文档没有剩余额度
+	if !strings.Contains(questions[0], `<document name="new.txt">`) || !strings.Contains(questions[0], documentTruncated) ||
+		estimateTokens(questions[0]) > 600 {
+		t.Errorf("expected truncated document in question %q", questions[0])
+	}
+	if !strings.Contains(questions[1], `<document name="old.txt">`) || !strings.Contains(questions[1], documentTruncated) ||
+		!strings.HasSuffix(questions[1], "问题：old") {
+		t.Errorf("expected document in question %q", questions[1])
+	}
+}
+
+func TestModelContext(t *testing.T) {
+	if numCtx := modelNumCtx("stop                           \"<|im_end|>\"\nnum_ctx                        8192"); numCtx != 8192 {
+		t.Errorf("expected 8192, got %d", numCtx)
+	}
+	if numCtx := modelNumCtx("temperature 0.7"); numCtx != 0 {
+		t.Errorf("expected 0, got %d", numCtx)
+	}
+	modelInfo := map[string]any{"general.architecture": "llama", "llama.context_length": float64(131072)}
+	if length := modelContextLength(modelInfo); length != 131072 {
+		t.Errorf("expected 131072, got %d", length)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	if tokens := estimateTokens("hello world"); tokens != 3+messageTokenOverhead {
+		t.Errorf("unexpected tokens %d", tokens)
+	}
+	if tokens := estimateTokens("你好"); tokens != 2+messageTokenOverhead {
+		t.Errorf("unexpected tokens %d", tokens)
+	}
+}
@@ -0,0 +1,147 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"ollama-desktop/internal/document"
+	"ollama-desktop/internal/log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 单个文档最大尺寸
+const maxDocumentSize = 20 * 1024 * 1024
+
+const (
+	documentPrompt = `请根据以下文档内容回答问题。
+
+%s
+问题：%s`
+	documentTemplate = "<document name=%q>\n%s\n</document>\n"
+	// 文档内容被截断时追加的提示
+	documentTruncated = "\n……（文档过长，后续内容已省略）"
+)
+
+// 提取问题中携带的文档文本，附件内容保存提取后的文本
+// 重新回答时从数据库加载的附件已经是提取后的文档，直接复用，请求中传入的文档始终重新提取
+func (c *Chat) prepareDocuments(sessionId, messageId string, documents []*ChatAttachmentModel) ([]*ChatAttachmentModel, error) {
+	var attachments []*ChatAttachmentModel
+	for _, doc := range documents {
+		if doc == nil || len(doc.Content) == 0 {
+			continue
+		}
+		content := doc.Content
+		if len(content) > maxDocumentSize {
+			return nil, errors.New("document size exceeds 20MB")
+		}
+		if !doc.stored || doc.AttachmentType != attachmentTypeDocument {
+			extracted, err := document.Extract(doc.FileName, content)
+			if err != nil {
+				log.Error().Err(err).Str("fileName", doc.FileName).Msg("extract document error")
+				return nil, fmt.Errorf("extract document %s error: %w", doc.FileName, err)
+			}
+			if extracted.Text == "" {
+				return nil, fmt.Errorf("document %s has no text content", doc.FileName)
+			}
+			content = []byte(extracted.Text)
+		}
+		attachments = append(attachments, &ChatAttachmentModel{
+			Id:             uuid.NewString(),
+			SessionId:      sessionId,
+			MessageId:      messageId,
+			AttachmentType: attachmentTypeDocument,
+			FileName:       doc.FileName,
+			MimeType:       "text/plain",
+			Content:        content,
+			CreatedAt:      time.Now(),
+		})
+	}
+	return attachments, nil
+}
+
+// 按附件类型拆分图片及文档
+func splitAttachments(attachments []*ChatAttachmentModel) (images, documents []*ChatAttachmentModel) {
+	for _, attachment := range attachments {
+		if attachment.AttachmentType == attachmentTypeDocument {
+			documents = append(documents, attachment)
+		} else {
+			images = append(images, attachment)
+		}
+	}
+	return images, documents
+}
+
+// 将文档内容加入问题，文档总长度超过 tokenLimit 时截断
+// 各文档平均分配 token，较短文档剩余的额度分给其他文档
+func documentQuestion(question string, documents []*ChatAttachmentModel, tokenLimit int) string {
+	if len(documents) == 0 {
+		return question
+	}
+	limits := documentLimits(documents, tokenLimit)
+	var builder strings.Builder
+	for i, doc := range documents {
+		builder.WriteString(fmt.Sprintf(documentTemplate, doc.FileName, truncateTokens(string(doc.Content), limits[i])))
+	}
+	return fmt.Sprintf(documentPrompt, builder.String(), question)
+}
+
+func documentLimits(documents []*ChatAttachmentModel, tokenLimit int) []int {
+	limits := make([]int, len(documents))
+	tokens := make([]int, len(documents))
+	remaining := len(documents)
+	for i, doc := range documents {
+		tokens[i] = estimateTokens(string(doc.Content))
+		limits[i] = -1
+	}
+	available := tokenLimit
+	if available < 0 {
+		available = 0
+	}
+	// 依次满足长度不超过平均额度的文档，直到剩余文档都需要截断
+	for remaining > 0 {
+		share := available / remaining
+		settled := false
+		for i := range documents {
+			if limits[i] < 0 && tokens[i] <= share {
+				limits[i] = tokens[i]
+				available -= tokens[i]
+				remaining--
+				settled = true
+			}
+		}
+		if !settled {
+			for i := range documents {
+				if limits[i] < 0 {
+					limits[i] = share
+				}
+			}
+			break
+		}
+	}
+	return limits
+}
+
+// 截断文本使估算的 token 数量不超过 limit
+func truncateTokens(text string, limit int) string {
+	if estimateTokens(text) <= limit {
+		return text
+	}
+	limit -= estimateTokens(documentTruncated)
+	if limit < 0 {
+		limit = 0
+	}
+	runes := []rune(text)
+	// 二分查找满足限制的最长前缀
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		if estimateTokens(string(runes[:mid])) <= limit {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:low]), unicode.IsSpace) + documentTruncated
+}
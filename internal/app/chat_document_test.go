@@ -0,0 +1,85 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocumentLimits(t *testing.T) {
+	documents := []*ChatAttachmentModel{
+		{Content: []byte(strings.Repeat("短", 10))},
+		{Content: []byte(strings.Repeat("长", 200))},
+		{Content: []byte(strings.Repeat("中", 80))},
+	}
+	// 估算值包含消息开销，短文档完整保留，剩余额度由另外两个文档平分
+	if limits := documentLimits(documents, 150); !reflect.DeepEqual(limits, []int{14, 68, 68}) {
+		t.Errorf("unexpected limits %v", limits)
+	}
+	if limits := documentLimits(documents, 1000); !reflect.DeepEqual(limits, []int{14, 204, 84}) {
+		t.Errorf("unexpected limits %v", limits)
+	}
+}
+
+func TestTruncateTokens(t *testing.T) {
+	if text := truncateTokens("short", 10); text != "short" {
+		t.Errorf("unexpected text %q", text)
+	}
+	text := truncateTokens(strings.Repeat("文", 100), 30)
+	if !strings.HasSuffix(text, documentTruncated) || estimateTokens(text) > 30 {
+		t.Errorf("unexpected truncated text %q", text)
+	}
+	if text := truncateTokens(strings.Repeat("文", 100), 0); text != documentTruncated {
+		t.Errorf("unexpected truncated text %q", text)
+	}
+}
+
+func TestDocumentQuestion(t *testing.T) {
+	if question := documentQuestion("What?", nil, 100); question != "What?" {
+		t.Errorf("unexpected question %q", question)
+	}
+	question := documentQuestion("What?", []*ChatAttachmentModel{
+		{FileName: "a.txt", Content: []byte("Alpha")},
+		{FileName: "b.md", Content: []byte("Beta")},
+	}, 100)
+	for _, expected := range []string{"<document name=\"a.txt\">\nAlpha\n</document>", "<document name=\"b.md\">\nBeta\n</document>", "问题：What?"} {
+		if !strings.Contains(question, expected) {
+			t.Errorf("expected %q in question %q", expected, question)
+		}
+	}
+}
+
+func TestSplitAttachments(t *testing.T) {
+	image := &ChatAttachmentModel{AttachmentType: attachmentTypeImage}
+	doc := &ChatAttachmentModel{AttachmentType: attachmentTypeDocument}
+	images, documents := splitAttachments([]*ChatAttachmentModel{image, doc})
+	if len(images) != 1 || images[0] != image || len(documents) != 1 || documents[0] != doc {
+		t.Errorf("unexpected split result %v %v", images, documents)
+	}
+}
+
+func TestPrepareDocuments(t *testing.T) {
+	c := &Chat{}
+	// 请求中传入的文档即使标记为已提取也需要重新提取
+	if _, err := c.prepareDocuments("s", "m", []*ChatAttachmentModel{
+		{AttachmentType: attachmentTypeDocument, FileName: "data.bin", Content: []byte{0, 1, 2}},
+	}); err == nil {
+		t.Error("expected error for unsupported document from request")
+	}
+	if _, err := c.prepareDocuments("s", "m", []*ChatAttachmentModel{
+		{AttachmentType: attachmentTypeDocument, FileName: "large.txt", Content: make([]byte, maxDocumentSize+1), stored: true},
+	}); err == nil {
+		t.Error("expected error for oversized document")
+	}
+	documents, err := c.prepareDocuments("s", "m", []*ChatAttachmentModel{
+		{AttachmentType: attachmentTypeDocument, FileName: "report.pdf", Content: []byte("extracted"), stored: true},
+		{FileName: "note.md", Content: []byte("# Title\n\nbody")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documents) != 2 || string(documents[0].Content) != "extracted" || documents[1].MessageId != "m" ||
+		documents[1].AttachmentType != attachmentTypeDocument {
+		t.Errorf("unexpected documents %+v", documents)
+	}
+}
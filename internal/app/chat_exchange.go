@@ -0,0 +1,716 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"html/template"
+	"net/http"
+	"ollama-desktop/internal/log"
+	"ollama-desktop/internal/pdf"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	exportFormatMarkdown = "markdown"
+	exportFormatHtml     = "html"
+	exportFormatPdf      = "pdf"
+	exportFormatJson     = "json"
+
+	// 导出 json 文件格式标识及版本，格式不兼容时需要升级版本
+	sessionExportFormat  = "ollama-desktop"
+	sessionExportVersion = 1
+
+	defaultMessageHistoryCount = 3
+	maxSessionNameLength       = 50
+)
+
+var invalidFileNameRegexp = regexp.MustCompile(`[\\/:*?"<>|\s]+`)
+
+// SessionExport 会话导出文件
+type SessionExport struct {
+	Format     string               `json:"format"`
+	Version    int                  `json:"version"`
+	ExportedAt time.Time            `json:"exportedAt"`
+	Sessions   []*SessionExportItem `json:"sessions"`
+}
+
+type SessionExportItem struct {
+	Session  *SessionModel       `json:"session"`
+	Messages []*ChatMessageModel `json:"messages"`
+}
+
+type ExportSessionsRequest struct {
+	SessionIds []string `json:"sessionIds"`
+	// 导出格式：markdown、html、pdf、json
+	Format string `json:"format"`
+}
+
+// ExportSessions 导出会话，弹出保存文件对话框，返回保存的文件路径，取消保存时返回空字符串
+func (c *Chat) ExportSessions(request *ExportSessionsRequest) (string, error) {
+	if len(request.SessionIds) == 0 {
+		return "", errors.New("no session selected")
+	}
+	var items []*SessionExportItem
+	for _, id := range request.SessionIds {
+		item, err := c.exportSession(id)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+	}
+
+	var content []byte
+	var ext, displayName string
+	var err error
+	switch request.Format {
+	case exportFormatMarkdown:
+		content, ext, displayName = exportMarkdown(items), ".md", "Markdown (*.md)"
+	case exportFormatHtml:
+		ext, displayName = ".html", "HTML (*.html)"
+		content, err = exportHtml(items)
+	case exportFormatPdf:
+		content, ext, displayName = exportPdf(items), ".pdf", "PDF (*.pdf)"
+	case exportFormatJson:
+		ext, displayName = ".json", "JSON (*.json)"
+		content, err = json.MarshalIndent(&SessionExport{
+			Format:     sessionExportFormat,
+			Version:    sessionExportVersion,
+			ExportedAt: time.Now(),
+			Sessions:   items,
+		}, "", "  ")
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", request.Format)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("export session error")
+		return "", err
+	}
+
+	filename := "ollama-desktop-sessions-" + time.Now().Format("20060102150405")
+	if len(items) == 1 {
+		filename = invalidFileNameRegexp.ReplaceAllString(items[0].Session.SessionName, "_")
+	}
+	path, err := runtime.SaveFileDialog(app.ctx, runtime.SaveDialogOptions{
+		DefaultFilename: filename + ext,
+		Filters: []runtime.FileFilter{
+			{DisplayName: displayName, Pattern: "*" + ext},
+		},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+	if !strings.HasSuffix(strings.ToLower(path), ext) {
+		path += ext
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		log.Error().Err(err).Msg("write export file error")
+		return "", err
+	}
+	return path, nil
+}
+
+// 查询会话及其全部消息，包含所有分支
+func (c *Chat) exportSession(sessionId string) (*SessionExportItem, error) {
+	session, err := c.GetSession(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	sqlStr := `select ` + chatMessageColumns + `
+            from t_chat_message
+            where session_id = ?
+            order by created_at`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, sessionId)
+	if err != nil {
+		log.Error().Err(err).Msg("query session chat message error")
+		return nil, err
+	}
+	defer rows.Close()
+	var messages []*ChatMessageModel
+	for rows.Next() {
+		message, err := c.scanChatMessage(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill chat message error")
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	ids := chatMessageIds(messages)
+	attachments, err := c.chatAttachments(ids)
+	if err != nil {
+		return nil, err
+	}
+	toolCalls, err := c.chatToolCalls(ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		message.Images, message.Documents = splitAttachments(attachments[message.Id])
+		message.ToolCalls = toolCalls[message.Id]
+	}
+	return &SessionExportItem{
+		Session:  session,
+		Messages: messages,
+	}, nil
+}
+
+// 当前分支上的消息，按从旧到新排序
+func (i *SessionExportItem) activePath() []*ChatMessageModel {
+	messages := make(map[string]*ChatMessageModel)
+	for _, message := range i.Messages {
+		messages[message.Id] = message
+	}
+	var path []*ChatMessageModel
+	visited := make(map[string]bool)
+	for id := i.Session.ActiveMessageId; id != "" && !visited[id]; {
+		visited[id] = true
+		message, ok := messages[id]
+		if !ok {
+			break
+		}
+		path = append([]*ChatMessageModel{message}, path...)
+		id = message.ParentId
+	}
+	return path
+}
+
+func imageDataUrl(image *ChatAttachmentModel) string {
+	return "data:" + image.MimeType + ";base64," + base64.StdEncoding.EncodeToString(image.Content)
+}
+
+func exportMarkdown(items []*SessionExportItem) []byte {
+	var buf bytes.Buffer
+	for index, item := range items {
+		if index > 0 {
+			buf.WriteString("\n---\n\n")
+		}
+		session := item.Session
+		fmt.Fprintf(&buf, "# %s\n\n", session.SessionName)
+		fmt.Fprintf(&buf, "- Model: %s\n- Created: %s\n\n", session.ModelName, session.CreatedAt.Format(time.DateTime))
+		if session.SystemMessage != "" {
+			fmt.Fprintf(&buf, "> **System**\n>\n> %s\n\n", strings.ReplaceAll(session.SystemMessage, "\n", "\n> "))
+		}
+		for _, message := range item.activePath() {
+			fmt.Fprintf(&buf, "## User\n\n%s\n\n", message.QuestionContent)
+			for _, image := range message.Images {
+				fmt.Fprintf(&buf, "![%s](%s)\n\n", image.FileName, imageDataUrl(image))
+			}
+			for _, doc := range message.Documents {
+				fmt.Fprintf(&buf, "*[document: %s]*\n\n", doc.FileName)
+			}
+			fmt.Fprintf(&buf, "## Assistant\n\n%s\n\n", message.AnswerContent)
+		}
+	}
+	return buf.Bytes()
+}
+
+var exportHtmlTemplate = template.Must(template.New("export").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Ollama Desktop</title>
+<style>
+body { max-width: 900px; margin: 0 auto; padding: 24px; font-family: -apple-system, "Segoe UI", "Microsoft YaHei", sans-serif; color: #303133; }
+h1 { border-bottom: 1px solid #dcdfe6; padding-bottom: 8px; }
+.meta { color: #909399; font-size: 13px; }
+.message { margin: 16px 0; padding: 12px 16px; border-radius: 8px; }
+.system { background: #fdf6ec; }
+.user { background: #ecf5ff; }
+.assistant { background: #f4f4f5; }
+.role { font-weight: bold; margin-bottom: 8px; }
+.content { white-space: pre-wrap; word-break: break-word; }
+.document { margin-top: 8px; color: #606266; font-size: 13px; }
+img { max-width: 100%; margin-top: 8px; border-radius: 4px; }
+</style>
+</head>
+<body>
+{{range .}}
+<section>
+<h1>{{.Session.SessionName}}</h1>
+<div class="meta">Model: {{.Session.ModelName}} · Created: {{.Session.CreatedAt.Format "2006-01-02 15:04:05"}}</div>
+{{if .Session.SystemMessage}}<div class="message system"><div class="role">System</div><div class="content">{{.Session.SystemMessage}}</div></div>{{end}}
+{{range .Messages}}
+<div class="message user"><div class="role">User</div><div class="content">{{.Question}}</div>{{range .Images}}<img src="{{.}}">{{end}}{{range .Documents}}<div class="document">[document: {{.}}]</div>{{end}}</div>
+<div class="message assistant"><div class="role">Assistant</div><div class="content">{{.Answer}}</div></div>
+{{end}}
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+func exportHtml(items []*SessionExportItem) ([]byte, error) {
+	type htmlMessage struct {
+		Question  string
+		Answer    string
+		Images    []template.URL
+		Documents []string
+	}
+	type htmlSession struct {
+		Session  *SessionModel
+		Messages []*htmlMessage
+	}
+	var sessions []*htmlSession
+	for _, item := range items {
+		session := &htmlSession{Session: item.Session}
+		for _, message := range item.activePath() {
+			htmlMessage := &htmlMessage{
+				Question: message.QuestionContent,
+				Answer:   message.AnswerContent,
+			}
+			for _, image := range message.Images {
+				// 仅输出图片类型的 data URL，避免导入的数据注入其他协议的链接
+				if !strings.HasPrefix(image.MimeType, "image/") || len(image.Content) > maxImageSize {
+					continue
+				}
+				htmlMessage.Images = append(htmlMessage.Images, template.URL(imageDataUrl(image)))
+			}
+			for _, doc := range message.Documents {
+				htmlMessage.Documents = append(htmlMessage.Documents, doc.FileName)
+			}
+			session.Messages = append(session.Messages, htmlMessage)
+		}
+		sessions = append(sessions, session)
+	}
+	var buf bytes.Buffer
+	if err := exportHtmlTemplate.Execute(&buf, sessions); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func exportPdf(items []*SessionExportItem) []byte {
+	doc := pdf.New()
+	for index, item := range items {
+		if index > 0 {
+			doc.PageBreak()
+		}
+		session := item.Session
+		doc.Heading(session.SessionName)
+		doc.Paragraph(fmt.Sprintf("Model: %s    Created: %s", session.ModelName, session.CreatedAt.Format(time.DateTime)))
+		if session.SystemMessage != "" {
+			doc.Subheading("System")
+			doc.Paragraph(session.SystemMessage)
+		}
+		for _, message := range item.activePath() {
+			doc.Subheading("User")
+			doc.Paragraph(message.QuestionContent)
+			for _, image := range message.Images {
+				doc.Paragraph(fmt.Sprintf("[image: %s]", image.FileName))
+			}
+			for _, document := range message.Documents {
+				doc.Paragraph(fmt.Sprintf("[document: %s]", document.FileName))
+			}
+			doc.Subheading("Assistant")
+			doc.Paragraph(message.AnswerContent)
+		}
+	}
+	return doc.Bytes()
+}
+
+type ImportSessionsRequest struct {
+	// 导入其他应用的会话时使用的模型，为空时使用导出文件中的模型
+	ModelName string `json:"modelName"`
+}
+
+// ImportSessions 导入会话，弹出打开文件对话框，支持本应用导出的 json 以及 ChatGPT、Open WebUI 导出的会话
+func (c *Chat) ImportSessions(request *ImportSessionsRequest) ([]*SessionModel, error) {
+	path, err := runtime.OpenFileDialog(app.ctx, runtime.OpenDialogOptions{
+		Filters: []runtime.FileFilter{
+			{DisplayName: "JSON (*.json)", Pattern: "*.json"},
+		},
+	})
+	if err != nil || path == "" {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Error().Err(err).Msg("read import file error")
+		return nil, err
+	}
+	items, err := parseSessionImport(content, request.ModelName)
+	if err != nil {
+		log.Error().Err(err).Msg("parse import file error")
+		return nil, err
+	}
+	var sessions []*SessionModel
+	err = dao.transaction(func(tx *sql.Tx) error {
+		for _, item := range items {
+			item.renew()
+			if err := c.insertSession(tx, item.Session); err != nil {
+				return err
+			}
+			for _, message := range item.Messages {
+				if err := c.insertChatMessage(tx, message); err != nil {
+					return err
+				}
+			}
+			sessions = append(sessions, item.Session)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// 为导入的会话及消息重新生成编号，避免与已有数据冲突
+func (i *SessionExportItem) renew() {
+	session := i.Session
+	session.Id = uuid.NewString()
+	// 文件夹不随会话导出，导入的会话不放入文件夹
+	session.FolderId = ""
+	if session.MessageHistoryCount <= 0 {
+		session.MessageHistoryCount = defaultMessageHistoryCount
+	}
+	if session.NameSource == "" {
+		session.NameSource = sessionNameManual
+	}
+	if runes := []rune(session.SessionName); len(runes) > maxSessionNameLength {
+		session.SessionName = string(runes[:maxSessionNameLength])
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	session.UpdatedAt = time.Now()
+
+	ids := make(map[string]string)
+	for _, message := range i.Messages {
+		ids[message.Id] = uuid.NewString()
+	}
+	for _, message := range i.Messages {
+		message.Id = ids[message.Id]
+		message.SessionId = session.Id
+		message.ParentId = ids[message.ParentId]
+		if message.CreatedAt.IsZero() {
+			message.CreatedAt = session.CreatedAt
+		}
+		if message.UpdatedAt.IsZero() {
+			message.UpdatedAt = message.CreatedAt
+		}
+		switch message.Status {
+		case "":
+			message.Status = messageStatusDone
+		case messageStatusRunning:
+			message.Status = messageStatusInterrupted
+		}
+		// 早期导出的文件中文档与图片混在一起，重新按类型拆分
+		message.Images, message.Documents = splitAttachments(append(message.Images, message.Documents...))
+		for _, attachment := range append(message.Images, message.Documents...) {
+			attachment.Id = uuid.NewString()
+			attachment.SessionId = session.Id
+			attachment.MessageId = message.Id
+		}
+		for _, toolCall := range message.ToolCalls {
+			toolCall.Id = uuid.NewString()
+			toolCall.SessionId = session.Id
+			toolCall.MessageId = message.Id
+		}
+	}
+	if activeId, ok := ids[session.ActiveMessageId]; ok {
+		session.ActiveMessageId = activeId
+	} else if len(i.Messages) > 0 {
+		session.ActiveMessageId = i.Messages[len(i.Messages)-1].Id
+	} else {
+		session.ActiveMessageId = ""
+	}
+	// 摘要对应的消息不存在时丢弃摘要
+	if summaryId, ok := ids[session.SummaryMessageId]; ok {
+		session.SummaryMessageId = summaryId
+	} else {
+		session.Summary, session.SummaryMessageId = "", ""
+	}
+}
+
+// 识别导入文件的格式并解析为会话
+func parseSessionImport(content []byte, modelName string) ([]*SessionExportItem, error) {
+	content = bytes.TrimSpace(content)
+	var objects []map[string]json.RawMessage
+	if bytes.HasPrefix(content, []byte("[")) {
+		if err := json.Unmarshal(content, &objects); err != nil {
+			return nil, err
+		}
+	} else {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(content, &object); err != nil {
+			return nil, err
+		}
+		if _, ok := object["sessions"]; ok {
+			return parseDesktopImport(content)
+		}
+		objects = append(objects, object)
+	}
+
+	var items []*SessionExportItem
+	for _, object := range objects {
+		var item *SessionExportItem
+		var err error
+		if _, ok := object["mapping"]; ok {
+			item, err = parseChatGptImport(object, modelName)
+		} else if _, ok := object["chat"]; ok {
+			item, err = parseOpenWebUIImport(object, modelName)
+		} else {
+			return nil, errors.New("unsupported import file format")
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func parseDesktopImport(content []byte) ([]*SessionExportItem, error) {
+	var export SessionExport
+	if err := json.Unmarshal(content, &export); err != nil {
+		return nil, err
+	}
+	if export.Format != sessionExportFormat {
+		return nil, errors.New("unsupported import file format")
+	}
+	if export.Version > sessionExportVersion {
+		return nil, fmt.Errorf("unsupported export version %d, please upgrade Ollama Desktop", export.Version)
+	}
+	for _, item := range export.Sessions {
+		if item.Session == nil {
+			return nil, errors.New("invalid session in import file")
+		}
+		for _, message := range item.Messages {
+			if err := checkImportAttachments(message); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return export.Sessions, nil
+}
+
+// 按上传时的规则校验导入的附件，图片类型以内容识别的结果为准
+func checkImportAttachments(message *ChatMessageModel) error {
+	images, documents := splitAttachments(append(message.Images, message.Documents...))
+	for _, image := range images {
+		if len(image.Content) > maxImageSize {
+			return errors.New("image size exceeds 20MB")
+		}
+		mimeType := http.DetectContentType(image.Content)
+		if !strings.HasPrefix(mimeType, "image/") {
+			return errInvalidImage
+		}
+		image.MimeType = mimeType
+	}
+	for _, doc := range documents {
+		if len(doc.Content) > maxDocumentSize {
+			return errors.New("document size exceeds 20MB")
+		}
+	}
+	return nil
+}
+
+var errImportMessageCycle = errors.New("invalid import file: message parents form a cycle")
+
+// 导入的单条消息
+type importTurn struct {
+	role      string
+	content   string
+	createdAt time.Time
+}
+
+// 将消息按问答配对为会话消息，连续的回答会被合并
+func newImportItem(title, modelName string, createdAt time.Time, turns []*importTurn) *SessionExportItem {
+	item := &SessionExportItem{
+		Session: &SessionModel{
+			SessionName:         title,
+			ModelName:           modelName,
+			MessageHistoryCount: defaultMessageHistoryCount,
+			CreatedAt:           createdAt,
+		},
+	}
+	var current *ChatMessageModel
+	for _, turn := range turns {
+		if turn.content == "" {
+			continue
+		}
+		if turn.role == messageRoleUser || current == nil {
+			parentId := ""
+			if current != nil {
+				parentId = current.Id
+			}
+			current = &ChatMessageModel{
+				Id:        uuid.NewString(),
+				ParentId:  parentId,
+				CreatedAt: turn.createdAt,
+				UpdatedAt: turn.createdAt,
+			}
+			item.Messages = append(item.Messages, current)
+		}
+		if turn.role == messageRoleUser {
+			current.QuestionContent = turn.content
+			continue
+		}
+		if current.AnswerContent != "" {
+			current.AnswerContent += "\n\n"
+		}
+		current.AnswerContent += turn.content
+		current.IsSuccess = true
+		current.UpdatedAt = turn.createdAt
+	}
+	if item.Session.SessionName == "" {
+		item.Session.SessionName = "Imported"
+	}
+	return item
+}
+
+func unixTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// 解析 ChatGPT 导出的 conversations.json 中的单个会话
+func parseChatGptImport(object map[string]json.RawMessage, modelName string) (*SessionExportItem, error) {
+	var conversation struct {
+		Title            string  `json:"title"`
+		CreateTime       float64 `json:"create_time"`
+		CurrentNode      string  `json:"current_node"`
+		DefaultModelSlug string  `json:"default_model_slug"`
+		Mapping          map[string]struct {
+			Parent  string `json:"parent"`
+			Message *struct {
+				Author struct {
+					Role string `json:"role"`
+				} `json:"author"`
+				Content struct {
+					ContentType string            `json:"content_type"`
+					Parts       []json.RawMessage `json:"parts"`
+				} `json:"content"`
+				CreateTime float64 `json:"create_time"`
+			} `json:"message"`
+		} `json:"mapping"`
+	}
+	bts, _ := json.Marshal(object)
+	if err := json.Unmarshal(bts, &conversation); err != nil {
+		return nil, err
+	}
+	var turns []*importTurn
+	visited := make(map[string]bool)
+	for id := conversation.CurrentNode; id != ""; {
+		if visited[id] {
+			return nil, errImportMessageCycle
+		}
+		visited[id] = true
+		node, ok := conversation.Mapping[id]
+		if !ok {
+			break
+		}
+		id = node.Parent
+		message := node.Message
+		if message == nil || message.Content.ContentType != "text" {
+			continue
+		}
+		role := message.Author.Role
+		if role != messageRoleUser && role != messageRoleAssistant {
+			continue
+		}
+		var parts []string
+		for _, part := range message.Content.Parts {
+			var text string
+			if json.Unmarshal(part, &text) == nil && text != "" {
+				parts = append(parts, text)
+			}
+		}
+		turns = append([]*importTurn{{
+			role:      role,
+			content:   strings.Join(parts, "\n"),
+			createdAt: unixTime(message.CreateTime),
+		}}, turns...)
+	}
+	if modelName == "" {
+		modelName = conversation.DefaultModelSlug
+	}
+	return newImportItem(conversation.Title, modelName, unixTime(conversation.CreateTime), turns), nil
+}
+
+// 解析 Open WebUI 导出的单个会话
+func parseOpenWebUIImport(object map[string]json.RawMessage, modelName string) (*SessionExportItem, error) {
+	type openWebUIMessage struct {
+		Id        string  `json:"id"`
+		ParentId  string  `json:"parentId"`
+		Role      string  `json:"role"`
+		Content   string  `json:"content"`
+		Timestamp float64 `json:"timestamp"`
+		Model     string  `json:"model"`
+	}
+	var export struct {
+		Title     string  `json:"title"`
+		CreatedAt float64 `json:"created_at"`
+		Chat      struct {
+			Title   string   `json:"title"`
+			Models  []string `json:"models"`
+			History struct {
+				Messages  map[string]*openWebUIMessage `json:"messages"`
+				CurrentId string                       `json:"currentId"`
+			} `json:"history"`
+			Messages  []*openWebUIMessage `json:"messages"`
+			Timestamp float64             `json:"timestamp"`
+		} `json:"chat"`
+	}
+	bts, _ := json.Marshal(object)
+	if err := json.Unmarshal(bts, &export); err != nil {
+		return nil, err
+	}
+	chat := export.Chat
+
+	var messages []*openWebUIMessage
+	visited := make(map[string]bool)
+	for id := chat.History.CurrentId; id != ""; {
+		if visited[id] {
+			return nil, errImportMessageCycle
+		}
+		visited[id] = true
+		message, ok := chat.History.Messages[id]
+		if !ok {
+			break
+		}
+		messages = append([]*openWebUIMessage{message}, messages...)
+		id = message.ParentId
+	}
+	if len(messages) == 0 {
+		messages = chat.Messages
+	}
+	var turns []*importTurn
+	for _, message := range messages {
+		if message.Role != messageRoleUser && message.Role != messageRoleAssistant {
+			continue
+		}
+		if modelName == "" && message.Model != "" {
+			modelName = message.Model
+		}
+		turns = append(turns, &importTurn{
+			role:      message.Role,
+			content:   message.Content,
+			createdAt: unixTime(message.Timestamp),
+		})
+	}
+	if modelName == "" && len(chat.Models) > 0 {
+		modelName = chat.Models[0]
+	}
+	title := export.Title
+	if title == "" {
+		title = chat.Title
+	}
+	createdAt := unixTime(export.CreatedAt)
+	if createdAt.IsZero() {
+		// 部分版本的时间戳为毫秒
+		createdAt = unixTime(chat.Timestamp / 1000)
+	}
+	return newImportItem(title, modelName, createdAt, turns), nil
+}
@@ -0,0 +1,176 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChatGptImport(t *testing.T) {
+	content := `[{
+		"title": "Greeting",
+		"create_time": 1700000000.5,
+		"current_node": "c",
+		"default_model_slug": "gpt-4",
+		"mapping": {
+			"root": {"parent": null, "message": null},
+			"s": {"parent": "root", "message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": ["system"]}}},
+			"a": {"parent": "s", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["hello"]}, "create_time": 1700000001}},
+			"b": {"parent": "a", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["hi"]}, "create_time": 1700000002}},
+			"b2": {"parent": "a", "message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["other"]}}},
+			"c": {"parent": "b", "message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["bye"]}}}
+		}
+	}]`
+	items, err := parseSessionImport([]byte(content), "llama3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(items))
+	}
+	item := items[0]
+	if item.Session.SessionName != "Greeting" || item.Session.ModelName != "llama3" {
+		t.Errorf("unexpected session %+v", item.Session)
+	}
+	if len(item.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(item.Messages))
+	}
+	first, second := item.Messages[0], item.Messages[1]
+	if first.QuestionContent != "hello" || first.AnswerContent != "hi" || !first.IsSuccess {
+		t.Errorf("unexpected first message %+v", first)
+	}
+	if second.QuestionContent != "bye" || second.AnswerContent != "" || second.ParentId != first.Id {
+		t.Errorf("unexpected second message %+v", second)
+	}
+}
+
+func TestParseOpenWebUIImport(t *testing.T) {
+	content := `{
+		"title": "Web UI",
+		"created_at": 1700000000,
+		"chat": {
+			"models": ["qwen2"],
+			"history": {
+				"currentId": "2",
+				"messages": {
+					"1": {"id": "1", "parentId": null, "role": "user", "content": "question", "timestamp": 1700000001},
+					"2": {"id": "2", "parentId": "1", "role": "assistant", "content": "answer", "model": "qwen2:7b"}
+				}
+			}
+		}
+	}`
+	items, err := parseSessionImport([]byte(content), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || len(items[0].Messages) != 1 {
+		t.Fatalf("unexpected items %+v", items)
+	}
+	item := items[0]
+	if item.Session.ModelName != "qwen2:7b" {
+		t.Errorf("unexpected model %s", item.Session.ModelName)
+	}
+	if message := item.Messages[0]; message.QuestionContent != "question" || message.AnswerContent != "answer" {
+		t.Errorf("unexpected message %+v", message)
+	}
+}
+
+func TestImportMessageCycle(t *testing.T) {
+	chatGpt := `{"title": "cycle", "current_node": "a", "mapping": {
+		"a": {"parent": "b", "message": null},
+		"b": {"parent": "a", "message": null}
+	}}`
+	openWebUI := `{"chat": {"history": {"currentId": "1", "messages": {
+		"1": {"id": "1", "parentId": "2", "role": "user", "content": "q"},
+		"2": {"id": "2", "parentId": "1", "role": "assistant", "content": "a"}
+	}}}}`
+	for _, content := range []string{chatGpt, openWebUI} {
+		if _, err := parseSessionImport([]byte(content), "llama3"); err != errImportMessageCycle {
+			t.Errorf("expected cycle error, got %v", err)
+		}
+	}
+	item := &SessionExportItem{
+		Session:  &SessionModel{ActiveMessageId: "a"},
+		Messages: []*ChatMessageModel{{Id: "a", ParentId: "b"}, {Id: "b", ParentId: "a"}},
+	}
+	if path := item.activePath(); len(path) != 2 {
+		t.Errorf("unexpected active path %+v", path)
+	}
+}
+
+func TestImportAttachments(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	message := &ChatMessageModel{Images: []*ChatAttachmentModel{{FileName: "a.png", MimeType: "text/html", Content: png}}}
+	if err := checkImportAttachments(message); err != nil || message.Images[0].MimeType != "image/png" {
+		t.Errorf("unexpected image %+v, %v", message.Images[0], err)
+	}
+	message = &ChatMessageModel{Images: []*ChatAttachmentModel{{FileName: "a.html", MimeType: "image/png", Content: []byte("<html></html>")}}}
+	if err := checkImportAttachments(message); err != errInvalidImage {
+		t.Errorf("expected invalid image error, got %v", err)
+	}
+	message = &ChatMessageModel{Images: []*ChatAttachmentModel{{FileName: "a.png", Content: append(png, make([]byte, maxImageSize)...)}}}
+	if err := checkImportAttachments(message); err == nil {
+		t.Error("expected size error")
+	}
+
+	// 导出时跳过非图片类型的内容
+	item := &SessionExportItem{
+		Session: &SessionModel{ActiveMessageId: "a"},
+		Messages: []*ChatMessageModel{{Id: "a", QuestionContent: "q", Images: []*ChatAttachmentModel{
+			{MimeType: "text/html", Content: []byte("<script>")},
+			{MimeType: "image/png", Content: png},
+		}}},
+	}
+	bts, err := exportHtml([]*SessionExportItem{item})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html := string(bts); strings.Contains(html, "text/html") || !strings.Contains(html, "data:image/png;base64,") {
+		t.Errorf("unexpected html %s", html)
+	}
+}
+
+func TestSessionExportItemRenew(t *testing.T) {
+	item := &SessionExportItem{
+		Session: &SessionModel{Id: "s", SessionName: "session", ActiveMessageId: "b"},
+		Messages: []*ChatMessageModel{
+			{Id: "a"},
+			{Id: "b", ParentId: "a", Images: []*ChatAttachmentModel{{Id: "i"}, {Id: "d", AttachmentType: attachmentTypeDocument}}},
+		},
+	}
+	item.renew()
+	a, b := item.Messages[0], item.Messages[1]
+	if item.Session.Id == "s" || a.Id == "a" || b.Id == "b" {
+		t.Fatal("ids are not renewed")
+	}
+	if b.ParentId != a.Id || item.Session.ActiveMessageId != b.Id || b.Images[0].MessageId != b.Id {
+		t.Error("references are not remapped")
+	}
+	if len(b.Images) != 1 || len(b.Documents) != 1 || b.Documents[0].Id == "d" || b.Documents[0].MessageId != b.Id {
+		t.Errorf("documents are not split from images: %+v %+v", b.Images, b.Documents)
+	}
+	if a.SessionId != item.Session.Id || a.ParentId != "" {
+		t.Errorf("unexpected message %+v", a)
+	}
+}
+
+func TestExportDocuments(t *testing.T) {
+	item := &SessionExportItem{
+		Session: &SessionModel{Id: "s", SessionName: "session", ActiveMessageId: "a"},
+		Messages: []*ChatMessageModel{{
+			Id:              "a",
+			QuestionContent: "question",
+			Documents:       []*ChatAttachmentModel{{FileName: "report.pdf", AttachmentType: attachmentTypeDocument, Content: []byte("text")}},
+		}},
+	}
+	markdown := string(exportMarkdown([]*SessionExportItem{item}))
+	if !strings.Contains(markdown, "[document: report.pdf]") || strings.Contains(markdown, "data:") {
+		t.Errorf("unexpected markdown %s", markdown)
+	}
+	content, err := exportHtml([]*SessionExportItem{item})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html := string(content); !strings.Contains(html, "[document: report.pdf]") || strings.Contains(html, "<img") {
+		t.Errorf("unexpected html %s", html)
+	}
+}
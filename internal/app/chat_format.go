@@ -0,0 +1,79 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"ollama-desktop/internal/jsonschema"
+	"strings"
+)
+
+const (
+	responseFormatJson = "json"
+
+	// 回答校验失败时要求模型重新回答的提示
+	formatRetryPrompt = "The previous answer is invalid: %s. Reply again with only the JSON value that satisfies the required format, without any explanation."
+)
+
+// 会话的结构化输出格式
+type responseFormat struct {
+	// 发送给 ollama 的 format 参数
+	raw    json.RawMessage
+	schema *jsonschema.Schema
+}
+
+// 解析会话的结构化输出格式，未设置时返回 nil
+func sessionResponseFormat(session *SessionModel) (*responseFormat, error) {
+	format := strings.TrimSpace(session.ResponseFormat)
+	if format == "" {
+		return nil, nil
+	}
+	if format == responseFormatJson {
+		return &responseFormat{raw: json.RawMessage(`"json"`)}, nil
+	}
+	schema, err := jsonschema.Parse([]byte(format))
+	if err != nil {
+		return nil, fmt.Errorf("invalid response format schema: %w", err)
+	}
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, []byte(format)); err != nil {
+		return nil, err
+	}
+	return &responseFormat{raw: buffer.Bytes(), schema: schema}, nil
+}
+
+// 校验回答内容，校验通过时保存规范化后的结构化结果，否则记录失败原因
+func (f *responseFormat) validate(message *ChatMessageModel, content string) error {
+	message.StructuredContent, message.StructuredError = "", ""
+	data := []byte(trimCodeFence(content))
+	var err error
+	if f.schema != nil {
+		_, err = f.schema.ValidateJSON(data)
+	} else if !json.Valid(data) {
+		err = fmt.Errorf("answer is not valid json")
+	}
+	if err != nil {
+		message.StructuredError = err.Error()
+		return err
+	}
+	var buffer bytes.Buffer
+	if err := json.Compact(&buffer, data); err != nil {
+		message.StructuredError = err.Error()
+		return err
+	}
+	message.StructuredContent = buffer.String()
+	return nil
+}
+
+// 去除模型可能添加的 markdown 代码块标记
+func trimCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") || !strings.HasSuffix(content, "```") || len(content) < 6 {
+		return content
+	}
+	content = strings.TrimSuffix(content[3:], "```")
+	if index := strings.IndexByte(content, '\n'); index >= 0 && !strings.ContainsAny(content[:index], "{[\"") {
+		content = content[index+1:]
+	}
+	return strings.TrimSpace(content)
+}
@@ -0,0 +1,46 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestResponseFormatValidate(t *testing.T) {
+	format, err := sessionResponseFormat(&SessionModel{ResponseFormat: `{
+		"type": "object",
+		"properties": {"city": {"type": "string"}, "temperature": {"type": "number"}},
+		"required": ["city", "temperature"]
+	}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(format.raw) != `{"type":"object","properties":{"city":{"type":"string"},"temperature":{"type":"number"}},"required":["city","temperature"]}` {
+		t.Errorf("unexpected format %s", format.raw)
+	}
+	message := &ChatMessageModel{}
+	if err := format.validate(message, "```json\n{\"city\": \"Toronto\", \"temperature\": 21.5}\n```"); err != nil {
+		t.Fatal(err)
+	}
+	if message.StructuredContent != `{"city":"Toronto","temperature":21.5}` || message.StructuredError != "" {
+		t.Errorf("unexpected message %+v", message)
+	}
+	if err := format.validate(message, `{"city": "Toronto"}`); err == nil {
+		t.Error("expected validation error")
+	}
+	if message.StructuredContent != "" || message.StructuredError != `missing required property "temperature"` {
+		t.Errorf("unexpected message %+v", message)
+	}
+
+	format, err = sessionResponseFormat(&SessionModel{ResponseFormat: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(format.raw) != `"json"` || format.schema != nil {
+		t.Errorf("unexpected format %s", format.raw)
+	}
+	if err := format.validate(message, "not json"); err == nil {
+		t.Error("expected validation error")
+	}
+	if _, err := sessionResponseFormat(&SessionModel{ResponseFormat: "xml"}); err == nil {
+		t.Error("expected invalid format error")
+	}
+}
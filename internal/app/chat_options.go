@@ -0,0 +1,241 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 会话参数格式版本
+// 版本 1：无版本号，参数名称为驼峰格式，参数值均为字符串，仅支持少量参数
+// 版本 2：{"version": 2, "values": {...}}，参数名称与值类型与 ollama 的参数一致
+const sessionOptionsVersion = 2
+
+const (
+	optionTypeInteger = "integer"
+	optionTypeNumber  = "number"
+	optionTypeBoolean = "boolean"
+	optionTypeString  = "string"
+	optionTypeArray   = "array"
+)
+
+// 版本 1 参数名称与 ollama 参数名称的对应关系
+var legacyOptionNames = map[string]string{
+	"seed":          "seed",
+	"numPredict":    "num_predict",
+	"topK":          "top_k",
+	"topP":          "top_p",
+	"numCtx":        "num_ctx",
+	"temperature":   "temperature",
+	"repeatPenalty": "repeat_penalty",
+}
+
+type SessionOptions struct {
+	Version int                    `json:"version"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+type OptionSchema struct {
+	Version int                 `json:"version"`
+	Options []*OptionDefinition `json:"options"`
+}
+
+type OptionDefinition struct {
+	// ollama 参数名称
+	Name string `json:"name"`
+	// 参数类型：integer、number、boolean、string、array
+	Type    string      `json:"type"`
+	Default interface{} `json:"default,omitempty"`
+	// 是否为模型加载时生效的参数
+	Runner bool `json:"runner"`
+}
+
+// OptionSchema 会话可设置的模型参数，与 ollama 的参数定义保持一致
+func (c *Chat) OptionSchema() *OptionSchema {
+	return &OptionSchema{
+		Version: sessionOptionsVersion,
+		Options: optionDefinitions(),
+	}
+}
+
+// 根据 olm.Options 生成参数定义，按参数名称排序
+func optionDefinitions() []*OptionDefinition {
+	defaults := reflect.ValueOf(olm.DefaultOptions())
+	var definitions []*OptionDefinition
+	for _, field := range reflect.VisibleFields(defaults.Type()) {
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous || name == "" {
+			continue
+		}
+		definition := &OptionDefinition{
+			Name:   name,
+			Type:   optionType(field.Type),
+			Runner: len(field.Index) > 1,
+		}
+		if value := defaults.FieldByIndex(field.Index); !value.IsZero() {
+			definition.Default = value.Interface()
+			if value.Kind() == reflect.Pointer {
+				definition.Default = value.Elem().Interface()
+			}
+		}
+		definitions = append(definitions, definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool {
+		return definitions[i].Name < definitions[j].Name
+	})
+	return definitions
+}
+
+func optionType(t reflect.Type) string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64:
+		return optionTypeInteger
+	case reflect.Float32, reflect.Float64:
+		return optionTypeNumber
+	case reflect.Bool:
+		return optionTypeBoolean
+	case reflect.Slice:
+		return optionTypeArray
+	}
+	return optionTypeString
+}
+
+// 解析会话参数为 ollama 请求参数，并按 olm.Options 校验参数类型
+// 已保存的参数中可能包含新版本 ollama 移除的参数，忽略未知参数
+func sessionOptions(session *SessionModel) (map[string]interface{}, error) {
+	return parseSessionOptions(session, false)
+}
+
+// 校验待保存的会话参数，未知参数同样视为错误
+func checkSessionOptions(session *SessionModel) error {
+	_, err := parseSessionOptions(session, true)
+	return err
+}
+
+func parseSessionOptions(session *SessionModel, strict bool) (map[string]interface{}, error) {
+	raw := strings.TrimSpace(session.Options)
+	if raw == "" {
+		return nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+		return nil, fmt.Errorf("invalid session options: %w", err)
+	}
+	var values map[string]interface{}
+	if _, ok := fields["version"]; ok {
+		options := &SessionOptions{}
+		if err := json.Unmarshal([]byte(raw), options); err != nil {
+			return nil, fmt.Errorf("invalid session options: %w", err)
+		}
+		if options.Version > sessionOptionsVersion {
+			return nil, fmt.Errorf("unsupported session options version %d", options.Version)
+		}
+		values = options.Values
+	} else {
+		var err error
+		if values, err = legacyOptions(fields); err != nil {
+			return nil, err
+		}
+	}
+	known := make(map[string]bool)
+	for _, definition := range optionDefinitions() {
+		known[definition.Name] = true
+	}
+	for name, value := range values {
+		// 空值表示使用模型默认值
+		if value == nil || value == "" {
+			delete(values, name)
+			continue
+		}
+		if !known[name] {
+			if strict {
+				return nil, &olm.OptionError{Option: name, Value: value}
+			}
+			log.Warn().Str("option", name).Msg("ignore unknown session option")
+			delete(values, name)
+		}
+	}
+	options := olm.DefaultOptions()
+	if err := options.FromMap(values); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
+
+// 转换版本 1 的参数，字符串参数值按参数类型解析
+func legacyOptions(fields map[string]json.RawMessage) (map[string]interface{}, error) {
+	types := make(map[string]string)
+	for _, definition := range optionDefinitions() {
+		types[definition.Name] = definition.Type
+	}
+	values := make(map[string]interface{})
+	for name, field := range fields {
+		var value string
+		if err := json.Unmarshal(field, &value); err != nil {
+			return nil, fmt.Errorf("invalid session option %q: %w", name, err)
+		}
+		if value == "" {
+			continue
+		}
+		if legacyName, ok := legacyOptionNames[name]; ok {
+			name = legacyName
+		}
+		optionType, ok := types[name]
+		if !ok {
+			// 旧版本忽略未知参数
+			log.Warn().Str("option", name).Msg("ignore unknown session option")
+			continue
+		}
+		switch optionType {
+		case optionTypeInteger:
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, &olm.OptionError{Option: name, Expected: optionType, Value: value}
+			}
+			values[name] = float64(number)
+		case optionTypeNumber:
+			number, err := strconv.ParseFloat(value, 32)
+			if err != nil {
+				return nil, &olm.OptionError{Option: name, Expected: optionType, Value: value}
+			}
+			values[name] = number
+		case optionTypeBoolean:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, &olm.OptionError{Option: name, Expected: optionType, Value: value}
+			}
+			values[name] = b
+		case optionTypeArray:
+			items := make([]interface{}, 0)
+			for _, item := range strings.Split(value, ",") {
+				items = append(items, item)
+			}
+			values[name] = items
+		default:
+			values[name] = value
+		}
+	}
+	return values, nil
+}
+
+// 获取整数类型的参数值
+func intOption(options map[string]interface{}, name string) (int, bool) {
+	switch value := options[name].(type) {
+	case int:
+		return value, true
+	case float64:
+		return int(value), true
+	}
+	return 0, false
+}
@@ -0,0 +1,84 @@
+package app
+
+import (
+	"errors"
+	olm "ollama-desktop/internal/ollama"
+	"reflect"
+	"testing"
+)
+
+func TestSessionOptions(t *testing.T) {
+	cases := []struct {
+		options  string
+		expected map[string]interface{}
+		err      string
+	}{
+		{``, nil, ""},
+		{`{"seed": "42", "topP": "0.5", "numCtx": "", "unknown": "1"}`, map[string]interface{}{"seed": float64(42), "top_p": 0.5}, ""},
+		{`{"stop": "a,b", "use_mmap": "false"}`, map[string]interface{}{"stop": []interface{}{"a", "b"}, "use_mmap": false}, ""},
+		{`{"topK": "abc"}`, nil, `option "top_k" must be of type integer`},
+		{`{"version": 2, "values": {"mirostat": 2, "num_gpu": 10, "presence_penalty": 1.5, "stop": ["</s>"], "seed": null}}`,
+			map[string]interface{}{"mirostat": float64(2), "num_gpu": float64(10), "presence_penalty": 1.5, "stop": []interface{}{"</s>"}}, ""},
+		{`{"version": 2, "values": {"num_ctx": 1.5}}`, nil, `option "num_ctx" must be of type integer`},
+		{`{"version": 2, "values": {"stop": "</s>"}}`, nil, `option "stop" must be of type array of strings`},
+		{`{"version": 2, "values": {"unknown": 1, "seed": 1}}`, map[string]interface{}{"seed": float64(1)}, ""},
+		{`{"version": 3, "values": {}}`, nil, "unsupported session options version 3"},
+	}
+	for _, c := range cases {
+		values, err := sessionOptions(&SessionModel{Options: c.options})
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("%s: expected error %q, got %v", c.options, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", c.options, err)
+			continue
+		}
+		if !reflect.DeepEqual(values, c.expected) {
+			t.Errorf("%s: expected %v, got %v", c.options, c.expected, values)
+		}
+	}
+
+	_, err := sessionOptions(&SessionModel{Options: `{"version": 2, "values": {"temperature": "hot"}}`})
+	var optionErr *olm.OptionError
+	if !errors.As(err, &optionErr) || optionErr.Option != "temperature" || optionErr.Expected != "float32" {
+		t.Errorf("expected option error, got %v", err)
+	}
+}
+
+func TestCheckSessionOptions(t *testing.T) {
+	if err := checkSessionOptions(&SessionModel{Options: `{"version": 2, "values": {"seed": 1, "num_ctx": null}}`}); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	err := checkSessionOptions(&SessionModel{Options: `{"version": 2, "values": {"unknown": 1}}`})
+	if err == nil || err.Error() != `unknown option "unknown"` {
+		t.Errorf("expected unknown option error, got %v", err)
+	}
+	if err := checkSessionOptions(&SessionModel{Options: `{"version": 2, "values": {"seed": "1"}}`}); err == nil {
+		t.Error("expected type error")
+	}
+}
+
+func TestOptionDefinitions(t *testing.T) {
+	definitions := make(map[string]*OptionDefinition)
+	for _, definition := range optionDefinitions() {
+		definitions[definition.Name] = definition
+	}
+	expected := map[string]string{
+		"mirostat": optionTypeInteger, "stop": optionTypeArray, "num_gpu": optionTypeInteger,
+		"presence_penalty": optionTypeNumber, "use_mmap": optionTypeBoolean, "penalize_newline": optionTypeBoolean,
+	}
+	for name, optionType := range expected {
+		if definition, ok := definitions[name]; !ok || definition.Type != optionType {
+			t.Errorf("unexpected definition of %s: %+v", name, definition)
+		}
+	}
+	if !definitions["num_ctx"].Runner || definitions["top_k"].Runner {
+		t.Error("unexpected runner flag")
+	}
+	if definitions["num_ctx"].Default != 2048 {
+		t.Errorf("unexpected default %v", definitions["num_ctx"].Default)
+	}
+}
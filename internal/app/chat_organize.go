@@ -0,0 +1,379 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"ollama-desktop/internal/log"
+	"strings"
+	"time"
+)
+
+const (
+	sessionSortCreated = "created"
+	sessionSortUpdated = "updated"
+	sessionSortName    = "name"
+
+	maxSessionTags       = 20
+	maxSessionTagLength  = 50
+	maxFolderNameLength  = 100
+	maxSessionsPageLimit = 500
+)
+
+type SessionFilters struct {
+	// 文件夹编号，为空表示全部会话
+	FolderId string `json:"folderId"`
+	// 只查询未放入文件夹的会话
+	Unfiled bool `json:"unfiled"`
+	// 包含全部标签的会话
+	Tags []string `json:"tags"`
+	// 会话名称关键字
+	Keyword    string `json:"keyword"`
+	PinnedOnly bool   `json:"pinnedOnly"`
+	// 为 true 时查询已归档的会话，否则只查询未归档的会话
+	Archived bool `json:"archived"`
+	// 排序字段：created、updated、name，置顶会话始终排在前面
+	SortBy string `json:"sortBy"`
+	// 是否升序，默认降序
+	Ascending bool `json:"ascending"`
+	Offset    int  `json:"offset"`
+	// 返回的最大数量，为 0 时返回全部
+	Limit int `json:"limit"`
+}
+
+// 根据过滤条件构建会话查询语句
+func sessionQuery(filters *SessionFilters) (string, []interface{}, error) {
+	if filters == nil {
+		filters = &SessionFilters{}
+	}
+	sqlStr := `select ` + sessionColumns + `
+            from t_session
+            where archived = ?`
+	args := []interface{}{filters.Archived}
+	if filters.Unfiled {
+		sqlStr += ` and folder_id = ''`
+	} else if filters.FolderId != "" {
+		sqlStr += ` and folder_id = ?`
+		args = append(args, filters.FolderId)
+	}
+	if filters.PinnedOnly {
+		sqlStr += ` and pinned = 1`
+	}
+	if keyword := strings.TrimSpace(filters.Keyword); keyword != "" {
+		sqlStr += ` and session_name like ? escape '\'`
+		args = append(args, "%"+escapeLike(keyword)+"%")
+	}
+	tags, err := normalizeTags(filters.Tags)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, tag := range tags {
+		sqlStr += ` and exists (select 1 from t_session_tag t where t.session_id = t_session.id and t.tag_name = ?)`
+		args = append(args, tag)
+	}
+
+	var column string
+	switch filters.SortBy {
+	case "", sessionSortCreated:
+		column = "created_at"
+	case sessionSortUpdated:
+		column = "updated_at"
+	case sessionSortName:
+		column = "session_name"
+	default:
+		return "", nil, fmt.Errorf("unsupported sort field %q", filters.SortBy)
+	}
+	direction := "desc"
+	if filters.Ascending {
+		direction = "asc"
+	}
+	sqlStr += ` order by pinned desc, ` + column + ` ` + direction + `, id`
+
+	if filters.Limit > 0 {
+		limit, offset := filters.Limit, filters.Offset
+		if limit > maxSessionsPageLimit {
+			limit = maxSessionsPageLimit
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		sqlStr += ` limit ? offset ?`
+		args = append(args, limit, offset)
+	} else if filters.Offset > 0 {
+		sqlStr += ` limit -1 offset ?`
+		args = append(args, filters.Offset)
+	}
+	return sqlStr, args, nil
+}
+
+// 去除标签首尾空白及重复标签，保持原有顺序
+func normalizeTags(tags []string) ([]string, error) {
+	var normalized []string
+	exists := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || exists[tag] {
+			continue
+		}
+		if len([]rune(tag)) > maxSessionTagLength {
+			return nil, fmt.Errorf("tag %q is too long", tag)
+		}
+		exists[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxSessionTags {
+		return nil, errors.New("too many tags")
+	}
+	return normalized, nil
+}
+
+// 查询会话的标签，以会话编号分组
+func (c *Chat) sessionTags(sessionIds []string) (map[string][]string, error) {
+	tags := make(map[string][]string)
+	if len(sessionIds) == 0 {
+		return tags, nil
+	}
+	args := make([]interface{}, len(sessionIds))
+	for i, id := range sessionIds {
+		args[i] = id
+	}
+	sqlStr := `select session_id, tag_name from t_session_tag
+            where session_id in (?` + strings.Repeat(", ?", len(sessionIds)-1) + `)
+            order by created_at, tag_name`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("query session tag error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sessionId, tag string
+		if err := rows.Scan(&sessionId, &tag); err != nil {
+			log.Error().Err(err).Msg("fill session tag error")
+			return nil, err
+		}
+		tags[sessionId] = append(tags[sessionId], tag)
+	}
+	return tags, nil
+}
+
+// 填充会话的标签
+func (c *Chat) fillSessionTags(sessions []*SessionModel) error {
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.Id
+	}
+	tags, err := c.sessionTags(ids)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		session.Tags = tags[session.Id]
+	}
+	return nil
+}
+
+func (c *Chat) replaceSessionTags(tx *sql.Tx, sessionId string, tags []string) error {
+	sqlStr := `delete from t_session_tag where session_id = ?`
+	if _, err := tx.ExecContext(app.ctx, sqlStr, sessionId); err != nil {
+		log.Error().Err(err).Msg("delete session tag error")
+		return err
+	}
+	sqlStr = `insert into t_session_tag(session_id, tag_name, created_at) values(?, ?, ?)`
+	now := time.Now()
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(app.ctx, sqlStr, sessionId, tag, now); err != nil {
+			log.Error().Err(err).Msg("create session tag error")
+			return err
+		}
+	}
+	return nil
+}
+
+// SetSessionTags 替换会话的标签
+func (c *Chat) SetSessionTags(sessionId string, tags []string) ([]string, error) {
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	return tags, dao.transaction(func(tx *sql.Tx) error {
+		return c.replaceSessionTags(tx, sessionId, tags)
+	})
+}
+
+type SessionTagCount struct {
+	TagName string `json:"tagName"`
+	Count   int    `json:"count"`
+}
+
+// SessionTags 查询所有标签及使用的会话数量，按使用次数排序
+func (c *Chat) SessionTags() ([]*SessionTagCount, error) {
+	sqlStr := `select tag_name, count(1) from t_session_tag
+            group by tag_name
+            order by count(1) desc, tag_name`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr)
+	if err != nil {
+		log.Error().Err(err).Msg("query session tag error")
+		return nil, err
+	}
+	defer rows.Close()
+	var counts []*SessionTagCount
+	for rows.Next() {
+		count := &SessionTagCount{}
+		if err := rows.Scan(&count.TagName, &count.Count); err != nil {
+			log.Error().Err(err).Msg("fill session tag error")
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
+
+// PinSession 置顶或取消置顶会话
+func (c *Chat) PinSession(sessionId string, pinned bool) error {
+	return c.updateSessionFlag(sessionId, "pinned", pinned)
+}
+
+// ArchiveSession 归档或取消归档会话，归档的会话不在默认列表中显示
+func (c *Chat) ArchiveSession(sessionId string, archived bool) error {
+	return c.updateSessionFlag(sessionId, "archived", archived)
+}
+
+func (c *Chat) updateSessionFlag(sessionId, column string, value bool) error {
+	sqlStr := `update t_session set ` + column + ` = ? where id = ?`
+	result, err := dao.db().ExecContext(app.ctx, sqlStr, value, sessionId)
+	if err != nil {
+		log.Error().Err(err).Str("column", column).Msg("update session error")
+		return err
+	}
+	if count, err := result.RowsAffected(); err == nil && count == 0 {
+		return errors.New("session not exists")
+	}
+	return nil
+}
+
+// MoveSession 将会话移动到文件夹，folderId 为空时移出文件夹
+func (c *Chat) MoveSession(sessionId, folderId string) error {
+	if folderId != "" {
+		if _, err := c.getFolder(folderId); err != nil {
+			return err
+		}
+	}
+	sqlStr := `update t_session set folder_id = ? where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, folderId, sessionId); err != nil {
+		log.Error().Err(err).Msg("move session error")
+		return err
+	}
+	return nil
+}
+
+type SessionFolderModel struct {
+	Id         string    `json:"id"`
+	FolderName string    `json:"folderName"`
+	SortOrder  int       `json:"sortOrder"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+
+	// 文件夹中未归档的会话数量
+	SessionCount int `json:"sessionCount"`
+}
+
+func folderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("folder name is required")
+	}
+	if len([]rune(name)) > maxFolderNameLength {
+		return "", errors.New("folder name is too long")
+	}
+	return name, nil
+}
+
+// Folders 查询所有文件夹
+func (c *Chat) Folders() ([]*SessionFolderModel, error) {
+	sqlStr := `select f.id, f.folder_name, f.sort_order, f.created_at, f.updated_at,
+                   (select count(1) from t_session s where s.folder_id = f.id and s.archived = 0)
+            from t_session_folder f
+            order by f.sort_order, f.created_at`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr)
+	if err != nil {
+		log.Error().Err(err).Msg("query session folder error")
+		return nil, err
+	}
+	defer rows.Close()
+	var folders []*SessionFolderModel
+	for rows.Next() {
+		folder := &SessionFolderModel{}
+		if err := rows.Scan(&folder.Id, &folder.FolderName, &folder.SortOrder, &folder.CreatedAt, &folder.UpdatedAt,
+			&folder.SessionCount); err != nil {
+			log.Error().Err(err).Msg("fill session folder error")
+			return nil, err
+		}
+		folders = append(folders, folder)
+	}
+	return folders, nil
+}
+
+func (c *Chat) getFolder(id string) (*SessionFolderModel, error) {
+	sqlStr := `select id, folder_name, sort_order, created_at, updated_at from t_session_folder where id = ?`
+	folder := &SessionFolderModel{}
+	err := dao.db().QueryRowContext(app.ctx, sqlStr, id).Scan(&folder.Id, &folder.FolderName, &folder.SortOrder,
+		&folder.CreatedAt, &folder.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors.New("folder not exists")
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("query session folder error")
+		return nil, err
+	}
+	return folder, nil
+}
+
+func (c *Chat) CreateFolder(folder *SessionFolderModel) (*SessionFolderModel, error) {
+	name, err := folderName(folder.FolderName)
+	if err != nil {
+		return nil, err
+	}
+	folder.Id = uuid.NewString()
+	folder.FolderName = name
+	folder.CreatedAt = time.Now()
+	folder.UpdatedAt = folder.CreatedAt
+	sqlStr := `insert into t_session_folder(id, folder_name, sort_order, created_at, updated_at) values(?, ?, ?, ?, ?)`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, folder.Id, folder.FolderName, folder.SortOrder,
+		folder.CreatedAt, folder.UpdatedAt); err != nil {
+		log.Error().Err(err).Msg("create session folder error")
+		return nil, err
+	}
+	return folder, nil
+}
+
+func (c *Chat) UpdateFolder(folder *SessionFolderModel) (*SessionFolderModel, error) {
+	name, err := folderName(folder.FolderName)
+	if err != nil {
+		return nil, err
+	}
+	sqlStr := `update t_session_folder set folder_name = ?, sort_order = ?, updated_at = ? where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, name, folder.SortOrder, time.Now(), folder.Id); err != nil {
+		log.Error().Err(err).Msg("update session folder error")
+		return nil, err
+	}
+	return c.getFolder(folder.Id)
+}
+
+// DeleteFolder 删除文件夹，文件夹中的会话移出文件夹
+func (c *Chat) DeleteFolder(id string) (string, error) {
+	return id, dao.transaction(func(tx *sql.Tx) error {
+		sqlStr := "delete from t_session_folder where id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete session folder error")
+			return err
+		}
+		sqlStr = "update t_session set folder_id = '' where folder_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("update session folder error")
+			return err
+		}
+		return nil
+	})
+}
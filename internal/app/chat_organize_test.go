@@ -0,0 +1,67 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSessionQuery(t *testing.T) {
+	sqlStr, args, err := sessionQuery(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(sqlStr, "order by pinned desc, created_at desc, id") || !reflect.DeepEqual(args, []interface{}{false}) {
+		t.Errorf("unexpected query %q %v", sqlStr, args)
+	}
+
+	sqlStr, args, err = sessionQuery(&SessionFilters{
+		FolderId:  "f",
+		Tags:      []string{" work ", "work", "go"},
+		Keyword:   "50%",
+		Archived:  true,
+		SortBy:    sessionSortName,
+		Ascending: true,
+		Offset:    20,
+		Limit:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"folder_id = ?", "session_name like ?", "order by pinned desc, session_name asc, id", "limit ? offset ?"} {
+		if !strings.Contains(sqlStr, expected) {
+			t.Errorf("expected %q in query %q", expected, sqlStr)
+		}
+	}
+	if count := strings.Count(sqlStr, "t_session_tag"); count != 2 {
+		t.Errorf("expected 2 tag conditions, got %d", count)
+	}
+	if expected := []interface{}{true, "f", `%50\%%`, "work", "go", 10, 20}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args %v, got %v", expected, args)
+	}
+
+	sqlStr, _, _ = sessionQuery(&SessionFilters{Unfiled: true, FolderId: "f", PinnedOnly: true})
+	if !strings.Contains(sqlStr, "folder_id = ''") || strings.Contains(sqlStr, "folder_id = ?") || !strings.Contains(sqlStr, "pinned = 1") {
+		t.Errorf("unexpected query %q", sqlStr)
+	}
+	if _, _, err := sessionQuery(&SessionFilters{SortBy: "size"}); err == nil {
+		t.Error("expected unsupported sort error")
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{" a ", "", "b", "a"})
+	if err != nil || !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("unexpected tags %v %v", tags, err)
+	}
+	if _, err := normalizeTags([]string{strings.Repeat("标", maxSessionTagLength+1)}); err == nil {
+		t.Error("expected tag too long error")
+	}
+	many := make([]string, maxSessionTags+1)
+	for i := range many {
+		many[i] = strings.Repeat("t", i+1)
+	}
+	if _, err := normalizeTags(many); err == nil {
+		t.Error("expected too many tags error")
+	}
+}
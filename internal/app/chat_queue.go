@@ -0,0 +1,230 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"ollama-desktop/internal/log"
+	"time"
+)
+
+const eventChatQueue = "chat_queue"
+
+// 会话的问答队列，同一会话同时只生成一个回答，其余问题按提交顺序等待
+type chatQueue struct {
+	running *chatQueueItem
+	pending []*chatQueueItem
+}
+
+type chatQueueItem struct {
+	ctx     context.Context
+	message *ChatMessageModel
+	// 是否在当前分支末尾追加，为 true 时在开始回答时才确定父消息，保证排队的问题能看到前一个回答
+	followActive bool
+	// 回答结束且结果保存后关闭
+	done chan struct{}
+}
+
+// ChatQueueState 会话队列状态，每次队列变化时通过 chat_queue 事件发送
+type ChatQueueState struct {
+	SessionId string `json:"sessionId"`
+	// 正在回答的问题，没有时为空
+	Running *ChatQueueMessage `json:"running"`
+	// 等待回答的问题，按回答顺序排序
+	Pending []*ChatQueueMessage `json:"pending"`
+}
+
+type ChatQueueMessage struct {
+	Id        string    `json:"id"`
+	SessionId string    `json:"sessionId"`
+	ParentId  string    `json:"parentId"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (item *chatQueueItem) state() *ChatQueueMessage {
+	return &ChatQueueMessage{
+		Id:        item.message.Id,
+		SessionId: item.message.SessionId,
+		ParentId:  item.message.ParentId,
+		Content:   item.message.QuestionContent,
+		CreatedAt: item.message.CreatedAt,
+	}
+}
+
+// 将问题加入会话队列，返回问题前面等待的数量，队列空闲时立即开始回答
+func (c *Chat) enqueue(item *chatQueueItem) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.queues == nil {
+		c.queues = make(map[string]*chatQueue)
+	}
+	sessionId := item.message.SessionId
+	queue, ok := c.queues[sessionId]
+	if !ok {
+		queue = &chatQueue{}
+		c.queues[sessionId] = queue
+		go c.runQueue(sessionId)
+	}
+	if item.done == nil {
+		item.done = make(chan struct{})
+	}
+	position := len(queue.pending)
+	if queue.running != nil {
+		position++
+	}
+	queue.pending = append(queue.pending, item)
+	c.emitQueueState(sessionId, queue)
+	return position
+}
+
+// 依次回答会话队列中的问题，队列为空时退出
+func (c *Chat) runQueue(sessionId string) {
+	for {
+		item := c.nextQueueItem(sessionId)
+		if item == nil {
+			return
+		}
+		c.runQueueItem(item)
+	}
+}
+
+func (c *Chat) nextQueueItem(sessionId string) *chatQueueItem {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	queue, ok := c.queues[sessionId]
+	if !ok {
+		return nil
+	}
+	queue.running = nil
+	if len(queue.pending) == 0 {
+		delete(c.queues, sessionId)
+		c.emitQueueState(sessionId, nil)
+		return nil
+	}
+	queue.running = queue.pending[0]
+	queue.pending = queue.pending[1:]
+	c.emitQueueState(sessionId, queue)
+	return queue.running
+}
+
+func (c *Chat) runQueueItem(item *chatQueueItem) {
+	defer close(item.done)
+	message := item.message
+	// 排队期间会话设置及当前分支可能已经变化，开始回答前重新读取会话
+	session, err := c.GetSession(message.SessionId)
+	if err != nil {
+		log.Error().Err(err).Str("sessionId", message.SessionId).Msg("get session error")
+		c.removeCancel(message.Id)
+		c.stream(message.Id).finish(err.Error(), false)
+		c.removeStream(message.Id)
+		return
+	}
+	if item.followActive {
+		message.ParentId = session.ActiveMessageId
+	}
+	c.chat(item.ctx, session, message)
+}
+
+// SessionQueue 查询会话的问答队列状态
+func (c *Chat) SessionQueue(sessionId string) *ChatQueueState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return queueState(sessionId, c.queues[sessionId])
+}
+
+// RemoveQueuedMessage 将等待中的问题移出队列，问题不会被回答也不会被保存
+func (c *Chat) RemoveQueuedMessage(messageId string) error {
+	if !c.removeQueued(messageId) {
+		return errors.New("message is not waiting in queue")
+	}
+	return nil
+}
+
+func (c *Chat) removeQueued(messageId string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for sessionId, queue := range c.queues {
+		for i, item := range queue.pending {
+			if item.message.Id != messageId {
+				continue
+			}
+			queue.pending = append(queue.pending[:i:i], queue.pending[i+1:]...)
+			if cancel, ok := c.cancels[messageId]; ok {
+				cancel()
+				delete(c.cancels, messageId)
+			}
+			c.cancelStream(messageId)
+			c.emitQueueState(sessionId, queue)
+			return true
+		}
+	}
+	return false
+}
+
+// 清空会话中等待的问题并停止正在进行的回答，用于删除会话
+// 等待正在进行的回答结束，避免回答结束时保存的数据在会话删除后写入
+func (c *Chat) clearQueue(sessionId string) {
+	if done := c.cancelQueue(sessionId); done != nil {
+		<-done
+	}
+}
+
+// 取消会话队列中的全部问题，返回正在进行的回答的结束通知
+func (c *Chat) cancelQueue(sessionId string) <-chan struct{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	queue, ok := c.queues[sessionId]
+	if !ok {
+		return nil
+	}
+	items := queue.pending
+	if queue.running != nil {
+		items = append(items, queue.running)
+	}
+	for _, item := range items {
+		if cancel, ok := c.cancels[item.message.Id]; ok {
+			cancel()
+			delete(c.cancels, item.message.Id)
+		}
+	}
+	for _, item := range queue.pending {
+		c.cancelStream(item.message.Id)
+	}
+	queue.pending = nil
+	c.emitQueueState(sessionId, queue)
+	if queue.running != nil {
+		return queue.running.done
+	}
+	return nil
+}
+
+// 结束排队中问题的回答流并移除，调用时需持有锁
+func (c *Chat) cancelStream(messageId string) {
+	if stream, ok := c.streams[messageId]; ok {
+		stream.cancel()
+		delete(c.streams, messageId)
+	}
+}
+
+func queueState(sessionId string, queue *chatQueue) *ChatQueueState {
+	state := &ChatQueueState{
+		SessionId: sessionId,
+		Pending:   make([]*ChatQueueMessage, 0),
+	}
+	if queue == nil {
+		return state
+	}
+	if queue.running != nil {
+		state.Running = queue.running.state()
+	}
+	for _, item := range queue.pending {
+		state.Pending = append(state.Pending, item.state())
+	}
+	return state
+}
+
+// 发送队列状态，调用时需持有锁
+func (c *Chat) emitQueueState(sessionId string, queue *chatQueue) {
+	runtime.EventsEmit(app.ctx, eventChatQueue, queueState(sessionId, queue))
+}
@@ -0,0 +1,244 @@
+package app
+
+import (
+	"html"
+	"ollama-desktop/internal/log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	searchFieldQuestion = "question"
+	searchFieldAnswer   = "answer"
+
+	// trigram 分词要求检索词至少三个字符，更短的检索词退化为 like 查询
+	minSearchTermLength = 3
+	defaultSearchLimit  = 50
+
+	// 摘要高亮占位符，转义后替换为 html 标签
+	snippetMarkStart = "\x02"
+	snippetMarkEnd   = "\x03"
+	snippetEllipsis  = "..."
+	// like 查询时摘要截取的上下文长度
+	snippetContextLength = 32
+)
+
+type ChatSearchFilters struct {
+	SessionId string `json:"sessionId"`
+	ModelName string `json:"modelName"`
+	// 检索字段：question、answer，为空表示全部
+	Field     string     `json:"field"`
+	StartTime *time.Time `json:"startTime"`
+	EndTime   *time.Time `json:"endTime"`
+	Limit     int        `json:"limit"`
+}
+
+type ChatSearchHit struct {
+	SessionId       string    `json:"sessionId"`
+	SessionName     string    `json:"sessionName"`
+	MessageId       string    `json:"messageId"`
+	QuestionSnippet string    `json:"questionSnippet"`
+	AnswerSnippet   string    `json:"answerSnippet"`
+	Rank            float64   `json:"rank"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// Search 全文检索所有会话的问题与回答，摘要中的命中内容以 <mark> 标签包裹
+func (c *Chat) Search(query string, filters *ChatSearchFilters) ([]*ChatSearchHit, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	if filters == nil {
+		filters = &ChatSearchFilters{}
+	}
+	limit := filters.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+
+	sqlStr, args, useMatch := searchQuery(terms, filters, limit)
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("search chat message error")
+		return nil, err
+	}
+	defer rows.Close()
+	var hits []*ChatSearchHit
+	for rows.Next() {
+		hit := &ChatSearchHit{}
+		if err := rows.Scan(&hit.MessageId, &hit.SessionId, &hit.SessionName, &hit.QuestionSnippet, &hit.AnswerSnippet,
+			&hit.Rank, &hit.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("fill search hit error")
+			return nil, err
+		}
+		if !useMatch {
+			hit.QuestionSnippet = likeSnippet(hit.QuestionSnippet, terms)
+			hit.AnswerSnippet = likeSnippet(hit.AnswerSnippet, terms)
+		}
+		hit.QuestionSnippet = highlightSnippet(hit.QuestionSnippet)
+		hit.AnswerSnippet = highlightSnippet(hit.AnswerSnippet)
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// 构造检索语句，检索词均不少于三个字符时使用 fts5 检索，否则退化为 like 查询
+func searchQuery(terms []string, filters *ChatSearchFilters, limit int) (sqlStr string, args []interface{}, useMatch bool) {
+	useMatch = true
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < minSearchTermLength {
+			useMatch = false
+			break
+		}
+	}
+
+	if useMatch {
+		sqlStr = `select f.message_id, f.session_id, s.session_name,
+                   snippet(t_chat_message_fts, 2, ?, ?, ?, 16), snippet(t_chat_message_fts, 3, ?, ?, ?, 16),
+                   bm25(t_chat_message_fts), m.created_at
+            from t_chat_message_fts f
+            join t_chat_message m on m.id = f.message_id
+            join t_session s on s.id = f.session_id
+            where t_chat_message_fts match ?`
+		args = append(args, snippetMarkStart, snippetMarkEnd, snippetEllipsis,
+			snippetMarkStart, snippetMarkEnd, snippetEllipsis, matchExpression(terms, filters.Field))
+	} else {
+		sqlStr = `select f.message_id, f.session_id, s.session_name, f.question_content, f.answer_content, 0, m.created_at
+            from t_chat_message_fts f
+            join t_chat_message m on m.id = f.message_id
+            join t_session s on s.id = f.session_id
+            where 1 = 1`
+		for _, term := range terms {
+			pattern := "%" + escapeLike(term) + "%"
+			switch filters.Field {
+			case searchFieldQuestion:
+				sqlStr += ` and f.question_content like ? escape '\'`
+				args = append(args, pattern)
+			case searchFieldAnswer:
+				sqlStr += ` and f.answer_content like ? escape '\'`
+				args = append(args, pattern)
+			default:
+				sqlStr += ` and (f.question_content like ? escape '\' or f.answer_content like ? escape '\')`
+				args = append(args, pattern, pattern)
+			}
+		}
+	}
+	if filters.SessionId != "" {
+		sqlStr += ` and f.session_id = ?`
+		args = append(args, filters.SessionId)
+	}
+	if filters.ModelName != "" {
+		sqlStr += ` and s.model_name = ?`
+		args = append(args, filters.ModelName)
+	}
+	if filters.StartTime != nil {
+		sqlStr += ` and m.created_at >= ?`
+		args = append(args, *filters.StartTime)
+	}
+	if filters.EndTime != nil {
+		sqlStr += ` and m.created_at < ?`
+		args = append(args, *filters.EndTime)
+	}
+	if useMatch {
+		sqlStr += ` order by bm25(t_chat_message_fts)`
+	} else {
+		sqlStr += ` order by m.created_at desc`
+	}
+	sqlStr += ` limit ?`
+	args = append(args, limit)
+	return sqlStr, args, useMatch
+}
+
+// 构造 fts5 检索表达式，每个检索词作为短语匹配，避免用户输入被解析为检索语法
+func matchExpression(terms []string, field string) string {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	expression := strings.Join(phrases, " AND ")
+	switch field {
+	case searchFieldQuestion:
+		return "question_content : (" + expression + ")"
+	case searchFieldAnswer:
+		return "answer_content : (" + expression + ")"
+	}
+	return expression
+}
+
+func escapeLike(term string) string {
+	term = strings.ReplaceAll(term, `\`, `\\`)
+	term = strings.ReplaceAll(term, "%", `\%`)
+	return strings.ReplaceAll(term, "_", `\_`)
+}
+
+// 截取首个命中词附近的内容并标记所有命中词
+func likeSnippet(content string, terms []string) string {
+	runes := []rune(content)
+	position := -1
+	for _, term := range terms {
+		if i := indexFold(runes, term); i >= 0 && (position < 0 || i < position) {
+			position = i
+		}
+	}
+	if position < 0 {
+		return ""
+	}
+	start, end := position-snippetContextLength, position+snippetContextLength*2
+	prefix, suffix := snippetEllipsis, snippetEllipsis
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(runes) {
+		end, suffix = len(runes), ""
+	}
+	snippet := string(runes[start:end])
+	for _, term := range terms {
+		snippet = markTerm(snippet, term)
+	}
+	return prefix + snippet + suffix
+}
+
+// 忽略大小写查找命中词，返回字符位置
+// 大小写转换可能改变字节长度，因此在原内容上按字符窗口比较
+func indexFold(runes []rune, term string) int {
+	size := utf8.RuneCountInString(term)
+	if size == 0 {
+		return -1
+	}
+	for i := 0; i+size <= len(runes); i++ {
+		if strings.EqualFold(string(runes[i:i+size]), term) {
+			return i
+		}
+	}
+	return -1
+}
+
+// 忽略大小写标记命中词
+func markTerm(content, term string) string {
+	lowerContent, lowerTerm := strings.ToLower(content), strings.ToLower(term)
+	if term == "" || len(lowerContent) != len(content) || len(lowerTerm) != len(term) {
+		return strings.ReplaceAll(content, term, snippetMarkStart+term+snippetMarkEnd)
+	}
+	var builder strings.Builder
+	for {
+		i := strings.Index(lowerContent, lowerTerm)
+		if i < 0 {
+			builder.WriteString(content)
+			return builder.String()
+		}
+		builder.WriteString(content[:i])
+		builder.WriteString(snippetMarkStart)
+		builder.WriteString(content[i : i+len(term)])
+		builder.WriteString(snippetMarkEnd)
+		content, lowerContent = content[i+len(term):], lowerContent[i+len(term):]
+	}
+}
+
+// 转义摘要内容并将高亮占位符替换为 html 标签
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, snippetMarkStart, "<mark>")
+	return strings.ReplaceAll(snippet, snippetMarkEnd, "</mark>")
+}
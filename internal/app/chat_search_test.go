@@ -0,0 +1,149 @@
+package app
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchExpression(t *testing.T) {
+	for _, c := range []struct {
+		terms    []string
+		field    string
+		expected string
+	}{
+		{[]string{"hello"}, "", `"hello"`},
+		{[]string{`say"hi"`, "world"}, "", `"say""hi""" AND "world"`},
+		{[]string{`"`}, "", `""""`},
+		{[]string{"NEAR(a", "b)*", "-c", "x:y"}, "", `"NEAR(a" AND "b)*" AND "-c" AND "x:y"`},
+		{[]string{"问题检索"}, searchFieldQuestion, `question_content : ("问题检索")`},
+		{[]string{"answer", "OR"}, searchFieldAnswer, `answer_content : ("answer" AND "OR")`},
+	} {
+		if expression := matchExpression(c.terms, c.field); expression != c.expected {
+			t.Errorf("matchExpression(%q, %q) expected %s, got %s", c.terms, c.field, c.expected, expression)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	for term, expected := range map[string]string{
+		"plain":  "plain",
+		"50%":    `50\%`,
+		"a_b":    `a\_b`,
+		`c:\dir`: `c:\\dir`,
+		`\%_`:    `\\\%\_`,
+		"'quote": "'quote",
+	} {
+		if escaped := escapeLike(term); escaped != expected {
+			t.Errorf("escapeLike(%q) expected %q, got %q", term, expected, escaped)
+		}
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	// 检索词均不少于三个字符时使用 fts5
+	sqlStr, args, useMatch := searchQuery([]string{"hello", "世界好"}, &ChatSearchFilters{}, 10)
+	if !useMatch || !strings.Contains(sqlStr, "match ?") || strings.Contains(sqlStr, "like") {
+		t.Errorf("expected match query, got %s", sqlStr)
+	}
+	if expression := args[6]; expression != `"hello" AND "世界好"` || args[len(args)-1] != 10 {
+		t.Errorf("unexpected args %v", args)
+	}
+
+	// 中文短词退化为 like 查询，通配符被转义
+	sqlStr, args, useMatch = searchQuery([]string{"你好", "50%"}, &ChatSearchFilters{Field: searchFieldAnswer, SessionId: "s"}, 5)
+	if useMatch || strings.Contains(sqlStr, "match") || strings.Count(sqlStr, "f.answer_content like ? escape '\\'") != 2 {
+		t.Errorf("expected like query on answer, got %s", sqlStr)
+	}
+	if expected := []interface{}{"%你好%", `%50\%%`, "s", 5}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected args %v, got %v", expected, args)
+	}
+
+	sqlStr, args, _ = searchQuery([]string{"a_"}, &ChatSearchFilters{}, 5)
+	if !strings.Contains(sqlStr, "(f.question_content like ? escape '\\' or f.answer_content like ? escape '\\')") ||
+		!reflect.DeepEqual(args, []interface{}{`%a\_%`, `%a\_%`, 5}) {
+		t.Errorf("unexpected query %s %v", sqlStr, args)
+	}
+}
+
+// 在内存数据库中执行检索条件，确认用户输入不会被解析为检索语法或通配符
+func TestSearchExpressionExecution(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`create virtual table t_fts using fts5(question_content, answer_content, tokenize = 'trigram')`); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range [][2]string{
+		{`he said "hello" OR bye`, "answer one"},
+		{"discount 50% off", "中文内容检索"},
+		{"snake_case name", "plain"},
+		{"50 percent", "snakeXcase"},
+	} {
+		if _, err := db.Exec(`insert into t_fts(question_content, answer_content) values(?, ?)`, row[0], row[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	count := func(sqlStr string, args ...interface{}) int {
+		var n int
+		if err := db.QueryRow(sqlStr, args...).Scan(&n); err != nil {
+			t.Fatalf("query %s %v error: %v", sqlStr, args, err)
+		}
+		return n
+	}
+	for _, c := range []struct {
+		terms    []string
+		field    string
+		expected int
+	}{
+		{[]string{`"hello"`}, "", 1},
+		{[]string{"OR", "bye"}, "", 0},
+		{[]string{`"hello"`, "bye"}, searchFieldQuestion, 1},
+		{[]string{`"hello"`}, searchFieldAnswer, 0},
+		{[]string{"内容检"}, "", 1},
+		{[]string{"NEAR(x", "*)"}, "", 0},
+	} {
+		if n := count(`select count(*) from t_fts where t_fts match ?`, matchExpression(c.terms, c.field)); n != c.expected {
+			t.Errorf("match %q in %q expected %d, got %d", c.terms, c.field, c.expected, n)
+		}
+	}
+	for term, expected := range map[string]int{"50%": 1, "e_c": 1, "中文": 1, "%": 1, "_": 1} {
+		if n := count(`select count(*) from t_fts where question_content like ? escape '\' or answer_content like ? escape '\'`,
+			"%"+escapeLike(term)+"%", "%"+escapeLike(term)+"%"); n != expected {
+			t.Errorf("like %q expected %d, got %d", term, expected, n)
+		}
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	snippet := highlightSnippet(`<script>alert("` + snippetMarkStart + "x" + snippetMarkEnd + `")</script> & <mark>`)
+	expected := `&lt;script&gt;alert(&#34;<mark>x</mark>&#34;)&lt;/script&gt; &amp; &lt;mark&gt;`
+	if snippet != expected {
+		t.Errorf("expected %s, got %s", expected, snippet)
+	}
+}
+
+func TestLikeSnippet(t *testing.T) {
+	content := strings.Repeat("前", 40) + "你好<b>Hello</b>" + strings.Repeat("后", 80)
+	snippet := highlightSnippet(likeSnippet(content, []string{"你好", "hello"}))
+	if !strings.HasPrefix(snippet, snippetEllipsis) || !strings.HasSuffix(snippet, snippetEllipsis) {
+		t.Errorf("expected ellipsis around snippet %s", snippet)
+	}
+	if !strings.Contains(snippet, "<mark>你好</mark>&lt;b&gt;<mark>Hello</mark>&lt;/b&gt;") {
+		t.Errorf("unexpected snippet %s", snippet)
+	}
+	if snippet := likeSnippet("nothing", []string{"你好"}); snippet != "" {
+		t.Errorf("expected empty snippet, got %s", snippet)
+	}
+	// 小写后字节长度变化的字符不能影响命中位置
+	if snippet := likeSnippet("ȺȺȺȺȺȺȺȺ ab", []string{"ab"}); snippet != "ȺȺȺȺȺȺȺȺ "+snippetMarkStart+"ab"+snippetMarkEnd {
+		t.Errorf("unexpected snippet %q", snippet)
+	}
+	if snippet := likeSnippet("ȺȺȺȺȺȺȺȺ AB", []string{"ⱥ ab"}); !strings.Contains(snippet, "Ⱥ AB") {
+		t.Errorf("unexpected snippet %q", snippet)
+	}
+}
@@ -0,0 +1,217 @@
+package app
+
+import (
+	"errors"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 回答内容合并发送的间隔
+const streamFlushInterval = 50 * time.Millisecond
+
+// ChatStreamDelta 回答流事件，以消息编号为事件名称发送
+// 前端按 Seq 顺序拼接 Delta，Reset 为 true 时先清空已有内容，发现序号不连续时通过 StreamState 重新获取
+type ChatStreamDelta struct {
+	MessageId string `json:"messageId"`
+	// 从 1 开始递增的序号
+	Seq   int64  `json:"seq"`
+	Delta string `json:"delta"`
+	// 是否使用 Delta 替换已有内容，工具调用后的新一轮回答、结构化回答重试以及出错时内容会被替换
+	Reset   bool `json:"reset"`
+	Done    bool `json:"done"`
+	Success bool `json:"success"`
+	// 结束原因，排队中的问题被移出队列时为 canceled
+	DoneReason string `json:"doneReason,omitempty"`
+}
+
+// ChatStreamState 回答流当前状态，包含截至 Seq 的完整内容
+type ChatStreamState struct {
+	MessageId  string `json:"messageId"`
+	Seq        int64  `json:"seq"`
+	Content    string `json:"content"`
+	Done       bool   `json:"done"`
+	Success    bool   `json:"success"`
+	DoneReason string `json:"doneReason,omitempty"`
+}
+
+// 回答流，将回答内容按间隔合并为增量事件发送
+type chatStream struct {
+	messageId string
+	seq       int64
+	// 已发送的内容
+	content strings.Builder
+	// 等待发送的内容
+	pending    strings.Builder
+	reset      bool
+	done       bool
+	success    bool
+	doneReason string
+	timer      *time.Timer
+	lock       sync.Mutex
+}
+
+func newChatStream(messageId string) *chatStream {
+	return &chatStream{messageId: messageId}
+}
+
+// 追加回答内容
+func (s *chatStream) append(delta string) {
+	if delta == "" {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.done {
+		return
+	}
+	s.pending.WriteString(delta)
+	s.schedule()
+}
+
+// 使用新内容替换已有内容
+func (s *chatStream) replace(content string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.done {
+		return
+	}
+	s.pending.Reset()
+	s.pending.WriteString(content)
+	s.reset = true
+	s.schedule()
+}
+
+// 结束回答流并立即发送，content 与已有内容不一致时替换已有内容
+func (s *chatStream) finish(content string, success bool) {
+	s.end(content, success, "")
+}
+
+// 取消未开始回答的问题，发送结束事件避免前端一直等待
+func (s *chatStream) cancel() {
+	s.end("", false, doneReasonCanceled)
+}
+
+func (s *chatStream) end(content string, success bool, doneReason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.done {
+		return
+	}
+	if current := s.current(); current != content {
+		s.pending.Reset()
+		if !s.reset && strings.HasPrefix(content, s.content.String()) {
+			s.pending.WriteString(content[s.content.Len():])
+		} else {
+			s.pending.WriteString(content)
+			s.reset = true
+		}
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	s.done = true
+	s.success = success
+	s.doneReason = doneReason
+	s.emit()
+}
+
+func (s *chatStream) schedule() {
+	if s.timer == nil {
+		s.timer = time.AfterFunc(streamFlushInterval, s.flush)
+	}
+}
+
+func (s *chatStream) flush() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.timer = nil
+	if s.done || (s.pending.Len() == 0 && !s.reset) {
+		return
+	}
+	s.emit()
+}
+
+// 当前内容，包含未发送的部分，调用时需持有锁
+func (s *chatStream) current() string {
+	if s.reset {
+		return s.pending.String()
+	}
+	return s.content.String() + s.pending.String()
+}
+
+// 发送等待中的内容，调用时需持有锁
+func (s *chatStream) emit() {
+	runtime.EventsEmit(app.ctx, s.messageId, s.next())
+}
+
+// 生成下一个增量事件，调用时需持有锁
+// 回答进行中 Success 始终为 true，结束时才为实际结果
+func (s *chatStream) next() *ChatStreamDelta {
+	delta := s.pending.String()
+	if s.reset {
+		s.content.Reset()
+	}
+	s.content.WriteString(delta)
+	s.seq++
+	event := &ChatStreamDelta{
+		MessageId:  s.messageId,
+		Seq:        s.seq,
+		Delta:      delta,
+		Reset:      s.reset,
+		Done:       s.done,
+		Success:    !s.done || s.success,
+		DoneReason: s.doneReason,
+	}
+	s.pending.Reset()
+	s.reset = false
+	return event
+}
+
+func (s *chatStream) state() *ChatStreamState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return &ChatStreamState{
+		MessageId:  s.messageId,
+		Seq:        s.seq,
+		Content:    s.content.String(),
+		Done:       s.done,
+		Success:    !s.done || s.success,
+		DoneReason: s.doneReason,
+	}
+}
+
+// 获取消息的回答流，不存在时创建
+func (c *Chat) stream(messageId string) *chatStream {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.streams == nil {
+		c.streams = make(map[string]*chatStream)
+	}
+	stream, ok := c.streams[messageId]
+	if !ok {
+		stream = newChatStream(messageId)
+		c.streams[messageId] = stream
+	}
+	return stream
+}
+
+func (c *Chat) removeStream(messageId string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.streams, messageId)
+}
+
+// StreamState 获取进行中回答的当前内容，用于前端重新加载后继续接收回答
+// 之后只需处理序号大于返回 Seq 的事件，回答结束并保存后不再提供，应从历史消息中读取
+func (c *Chat) StreamState(messageId string) (*ChatStreamState, error) {
+	c.lock.Lock()
+	stream, ok := c.streams[messageId]
+	c.lock.Unlock()
+	if !ok {
+		return nil, errors.New("chat stream not exists")
+	}
+	return stream.state(), nil
+}
@@ -0,0 +1,26 @@
+package app
+
+import "testing"
+
+func TestChatStreamDelta(t *testing.T) {
+	s := newChatStream("m")
+	s.pending.WriteString("hello")
+	event := s.next()
+	if event.Seq != 1 || event.Delta != "hello" || event.Done || !event.Success {
+		t.Errorf("unexpected intermediate delta %+v", event)
+	}
+	if state := s.state(); state.Content != "hello" || state.Done || !state.Success {
+		t.Errorf("unexpected intermediate state %+v", state)
+	}
+
+	// 结束后才返回实际结果
+	s.pending.WriteString(" world")
+	s.done = true
+	event = s.next()
+	if event.Seq != 2 || event.Delta != " world" || !event.Done || event.Success {
+		t.Errorf("unexpected final delta %+v", event)
+	}
+	if state := s.state(); state.Content != "hello world" || !state.Done || state.Success {
+		t.Errorf("unexpected final state %+v", state)
+	}
+}
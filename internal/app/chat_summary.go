@@ -0,0 +1,170 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"strings"
+	"time"
+)
+
+const (
+	eventChatSummary = "chat_summary"
+
+	// 单次合并到摘要中的最大问答轮数
+	maxSummaryRounds = 20
+
+	summarySystemPrompt = `You maintain a running summary of a conversation between a user and an assistant.
+Merge the new conversation rounds into the existing summary. Keep facts, decisions, names, numbers, code identifiers
+and open questions that later rounds may depend on, and drop greetings and repetition.
+Write the summary in the same language as the conversation and output only the summary text.`
+	summaryMessagePrefix = "Summary of the earlier conversation:\n"
+)
+
+type ChatSummary struct {
+	SessionId        string `json:"sessionId"`
+	Summary          string `json:"summary"`
+	SummaryMessageId string `json:"summaryMessageId"`
+}
+
+// 会话摘要是否可用于指定的上一轮消息，摘要对应的消息不在当前分支上时摘要不可用
+func (c *Chat) usableSummary(session *SessionModel, parentId string) (bool, error) {
+	if !session.SummaryEnabled || session.Summary == "" || session.SummaryMessageId == "" || parentId == "" {
+		return false, nil
+	}
+	return c.onPath(parentId, session.SummaryMessageId)
+}
+
+// 回答成功后在后台将超出历史窗口的问答合并到摘要中
+func (c *Chat) summarize(session *SessionModel, message *ChatMessageModel) {
+	if !session.SummaryEnabled || !message.IsSuccess {
+		return
+	}
+	go func() {
+		if err := c.summarizeHistory(session.Id, message.Id); err != nil {
+			log.Error().Err(err).Str("sessionId", session.Id).Msg("summarize chat history error")
+		}
+	}()
+}
+
+func (c *Chat) summarizeHistory(sessionId, messageId string) error {
+	// 同一会话同时只生成一个摘要，未合并的问答由下一次摘要处理
+	if !c.startSummary(sessionId) {
+		return nil
+	}
+	defer c.finishSummary(sessionId)
+
+	session, err := c.GetSession(sessionId)
+	if err != nil {
+		return err
+	}
+	// 只为当前分支生成摘要
+	if !session.SummaryEnabled || session.ActiveMessageId != messageId {
+		return nil
+	}
+	// 下一轮对话会纳入最近的 MessageHistoryCount 轮问答，更早的问答需要合并到摘要中
+	messages, err := c.pathMessages(messageId, session.MessageHistoryCount, true, maxSummaryRounds)
+	if err != nil {
+		return err
+	}
+	summary, rounds := session.Summary, messages
+	for i, message := range messages {
+		if message.Id == session.SummaryMessageId {
+			rounds = messages[:i]
+			break
+		}
+	}
+	if len(rounds) == len(messages) {
+		// 摘要不在当前分支上，重新生成
+		summary = ""
+	}
+	if len(rounds) == 0 {
+		return nil
+	}
+
+	modelName := session.SummaryModelName
+	if modelName == "" {
+		modelName = session.ModelName
+	}
+	stream := false
+	request := &olm.GenerateRequest{
+		Model:  modelName,
+		System: summarySystemPrompt,
+		Prompt: summaryPrompt(summary, rounds),
+		Stream: &stream,
+	}
+	var buffer bytes.Buffer
+	if err := ollama.newApiClient().Generate(app.ctx, request, func(response olm.GenerateResponse) error {
+		buffer.WriteString(response.Response)
+		return nil
+	}); err != nil {
+		return err
+	}
+	summary = strings.TrimSpace(buffer.String())
+	if summary == "" {
+		return nil
+	}
+
+	chatSummary := &ChatSummary{
+		SessionId:        sessionId,
+		Summary:          summary,
+		SummaryMessageId: rounds[0].Id,
+	}
+	if err := c.saveSummary(chatSummary); err != nil {
+		return err
+	}
+	runtime.EventsEmit(app.ctx, eventChatSummary, chatSummary)
+	return nil
+}
+
+// 构造摘要提示词，rounds 按从新到旧排序
+func summaryPrompt(summary string, rounds []*ChatMessageModel) string {
+	var builder strings.Builder
+	builder.WriteString("Existing summary:\n")
+	if summary == "" {
+		builder.WriteString("(none)\n")
+	} else {
+		builder.WriteString(summary)
+		builder.WriteString("\n")
+	}
+	builder.WriteString("\nNew conversation rounds:\n")
+	for i := len(rounds) - 1; i >= 0; i-- {
+		fmt.Fprintf(&builder, "\nUser: %s\nAssistant: %s\n", rounds[i].QuestionContent, rounds[i].AnswerContent)
+	}
+	return builder.String()
+}
+
+func (c *Chat) saveSummary(summary *ChatSummary) error {
+	sqlStr := `update t_session set summary = ?, summary_message_id = ?, updated_at = ? where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, summary.Summary, summary.SummaryMessageId, time.Now(), summary.SessionId); err != nil {
+		log.Error().Err(err).Msg("update session summary error")
+		return err
+	}
+	return nil
+}
+
+// ClearSessionSummary 清除会话的历史摘要，之后超出历史窗口的问答会重新生成摘要
+func (c *Chat) ClearSessionSummary(sessionId string) (string, error) {
+	return sessionId, c.saveSummary(&ChatSummary{SessionId: sessionId})
+}
+
+func (c *Chat) startSummary(sessionId string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.summarizing == nil {
+		c.summarizing = make(map[string]bool)
+	}
+	if c.summarizing[sessionId] {
+		return false
+	}
+	c.summarizing[sessionId] = true
+	return true
+}
+
+func (c *Chat) finishSummary(sessionId string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.summarizing, sessionId)
+}
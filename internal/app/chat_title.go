@@ -0,0 +1,123 @@
+package app
+
+import (
+	"bytes"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"strings"
+	"time"
+)
+
+const (
+	eventSessionRenamed = "session_renamed"
+
+	sessionNameManual    = "manual"
+	sessionNamePending   = "pending"
+	sessionNameGenerated = "generated"
+
+	defaultSessionName = "新会话"
+	titleQuotes        = " \"'`“”‘’《》「」*"
+	titlePunctuation   = " 。.!！?？,，;；:："
+	// 生成标题时问题与回答截取的最大长度
+	maxTitleContentLength = 1000
+
+	titleSystemPrompt = `Generate a short title for the conversation below. Use at most 8 words, written in the same
+language as the conversation. Output only the title, without quotes, punctuation at the end or any explanation.`
+)
+
+type SessionRenamed struct {
+	SessionId   string `json:"sessionId"`
+	SessionName string `json:"sessionName"`
+}
+
+// 规范化会话名称并返回名称来源，名称为空时使用默认名称并等待自动生成
+func sessionName(name string) (string, string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return defaultSessionName, sessionNamePending
+	}
+	return name, sessionNameManual
+}
+
+// 首次回答成功后在后台为待生成名称的会话生成标题
+func (c *Chat) generateSessionName(session *SessionModel, message *ChatMessageModel) {
+	if session.NameSource != sessionNamePending || !message.IsSuccess {
+		return
+	}
+	go func() {
+		if err := c.generateTitle(session, message); err != nil {
+			log.Error().Err(err).Str("sessionId", session.Id).Msg("generate session name error")
+		}
+	}()
+}
+
+func (c *Chat) generateTitle(session *SessionModel, message *ChatMessageModel) error {
+	chatConfig, err := configStore.ChatConfigs()
+	if err != nil {
+		return err
+	}
+	modelName := chatConfig.TitleModelName
+	if modelName == "" {
+		modelName = session.ModelName
+	}
+	stream := false
+	request := &olm.GenerateRequest{
+		Model:  modelName,
+		System: titleSystemPrompt,
+		Prompt: "User: " + truncateRunes(message.QuestionContent, maxTitleContentLength) +
+			"\nAssistant: " + truncateRunes(message.AnswerContent, maxTitleContentLength),
+		Stream: &stream,
+	}
+	var buffer bytes.Buffer
+	if err := ollama.newApiClient().Generate(app.ctx, request, func(response olm.GenerateResponse) error {
+		buffer.WriteString(response.Response)
+		return nil
+	}); err != nil {
+		return err
+	}
+	title := cleanTitle(buffer.String())
+	if title == "" {
+		return nil
+	}
+
+	// 生成期间用户手动修改了名称时不再覆盖
+	sqlStr := `update t_session set session_name = ?, name_source = ?, updated_at = ? where id = ? and name_source = ?`
+	result, err := dao.db().ExecContext(app.ctx, sqlStr, title, sessionNameGenerated, time.Now(), session.Id, sessionNamePending)
+	if err != nil {
+		log.Error().Err(err).Msg("update session name error")
+		return err
+	}
+	if count, err := result.RowsAffected(); err != nil || count == 0 {
+		return err
+	}
+	runtime.EventsEmit(app.ctx, eventSessionRenamed, &SessionRenamed{
+		SessionId:   session.Id,
+		SessionName: title,
+	})
+	return nil
+}
+
+// 清理模型返回的标题，只保留首个非空行并去除引号、标题标记与结尾标点
+func cleanTitle(title string) string {
+	for _, line := range strings.Split(title, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimLeft(line, "# ")
+		line = strings.TrimPrefix(line, "Title:")
+		line = strings.TrimPrefix(line, "标题：")
+		line = strings.TrimRight(line, titlePunctuation)
+		line = strings.Trim(line, titleQuotes)
+		line = strings.TrimRight(line, titlePunctuation)
+		if line != "" {
+			return truncateRunes(line, maxSessionNameLength)
+		}
+	}
+	return ""
+}
+
+func truncateRunes(content string, length int) string {
+	if runes := []rune(content); len(runes) > length {
+		return string(runes[:length])
+	}
+	return content
+}
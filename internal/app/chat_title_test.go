@@ -0,0 +1,28 @@
+package app
+
+import (
+	"testing"
+)
+
+func TestCleanTitle(t *testing.T) {
+	cases := map[string]string{
+		"\"Go 并发编程\"\n":             "Go 并发编程",
+		"\n\nTitle: Sorting in Go.": "Sorting in Go",
+		"## 《天气查询》。\n解释":            "天气查询",
+		"  \n ":                     "",
+	}
+	for title, expected := range cases {
+		if actual := cleanTitle(title); actual != expected {
+			t.Errorf("cleanTitle(%q) = %q, expected %q", title, actual, expected)
+		}
+	}
+}
+
+func TestSessionName(t *testing.T) {
+	if name, source := sessionName("  "); name != defaultSessionName || source != sessionNamePending {
+		t.Errorf("unexpected name %s and source %s", name, source)
+	}
+	if name, source := sessionName(" 会话 "); name != "会话" || source != sessionNameManual {
+		t.Errorf("unexpected name %s and source %s", name, source)
+	}
+}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"strings"
+	"time"
+)
+
+const eventChatToolCall = "chat_tool_call"
+
+// Tools 可供会话启用的本地工具
+func (c *Chat) Tools() []*ToolInfo {
+	return toolRegistry.list()
+}
+
+// 执行模型请求的工具调用，调用失败时将错误信息作为结果回传给模型
+func (c *Chat) callTool(ctx context.Context, message *ChatMessageModel, round int, toolCall olm.ToolCall) *ChatToolCallModel {
+	function := toolCall.Function
+	toolCallModel := &ChatToolCallModel{
+		Id:        uuid.NewString(),
+		SessionId: message.SessionId,
+		MessageId: message.Id,
+		Round:     round,
+		ToolName:  function.Name,
+		Arguments: function.Arguments.String(),
+		CreatedAt: time.Now(),
+	}
+	if tool, ok := toolRegistry.get(function.Name); !ok {
+		toolCallModel.Result = "error: tool " + function.Name + " not found"
+	} else if result, err := tool.Call(ctx, function.Arguments); err != nil {
+		log.Error().Err(err).Str("tool", function.Name).Msg("call tool error")
+		toolCallModel.Result = "error: " + err.Error()
+	} else {
+		toolCallModel.Result = result
+		toolCallModel.IsSuccess = true
+	}
+	message.ToolCalls = append(message.ToolCalls, toolCallModel)
+	runtime.EventsEmit(app.ctx, eventChatToolCall, toolCallModel)
+	return toolCallModel
+}
+
+func (c *Chat) createChatToolCalls(tx *sql.Tx, toolCalls []*ChatToolCallModel) error {
+	sqlStr := `insert into t_chat_tool_call(id, session_id, message_id, round, tool_name, arguments, result, is_success, created_at)
+               values(?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, toolCall := range toolCalls {
+		if _, err := tx.ExecContext(app.ctx, sqlStr, toolCall.Id, toolCall.SessionId, toolCall.MessageId, toolCall.Round,
+			toolCall.ToolName, toolCall.Arguments, toolCall.Result, toolCall.IsSuccess, toolCall.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("create chat tool call error")
+			return err
+		}
+	}
+	return nil
+}
+
+// 查询消息关联的工具调用，以消息编号分组
+func (c *Chat) chatToolCalls(messageIds []string) (map[string][]*ChatToolCallModel, error) {
+	toolCalls := make(map[string][]*ChatToolCallModel)
+	if len(messageIds) == 0 {
+		return toolCalls, nil
+	}
+	args := make([]interface{}, len(messageIds))
+	for i, id := range messageIds {
+		args[i] = id
+	}
+	sqlStr := `select id, session_id, message_id, round, tool_name, arguments, result, is_success, created_at
+            from t_chat_tool_call
+            where message_id in (?` + strings.Repeat(", ?", len(messageIds)-1) + `)
+            order by created_at`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("query chat tool call error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		toolCall := &ChatToolCallModel{}
+		if err := rows.Scan(&toolCall.Id, &toolCall.SessionId, &toolCall.MessageId, &toolCall.Round, &toolCall.ToolName,
+			&toolCall.Arguments, &toolCall.Result, &toolCall.IsSuccess, &toolCall.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("fill chat tool call error")
+			return nil, err
+		}
+		toolCalls[toolCall.MessageId] = append(toolCalls[toolCall.MessageId], toolCall)
+	}
+	return toolCalls, nil
+}
@@ -0,0 +1,350 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"strings"
+	"sync"
+	"time"
+)
+
+var completion = Completion{}
+
+// 补全完成时发送，包含补全结果及统计信息
+const eventCompletionDone = "completion_done"
+
+// Completion 文本补全，直接调用 generate 接口，用于调试提示词模板
+type Completion struct {
+	// 正在进行中的补全，用于取消
+	cancels map[string]context.CancelFunc
+	lock    sync.Mutex
+}
+
+type CompletionRunModel struct {
+	Id                 string        `json:"id"`
+	ParentId           string        `json:"parentId"`
+	ModelName          string        `json:"modelName"`
+	Prompt             string        `json:"prompt"`
+	Suffix             string        `json:"suffix"`
+	SystemMessage      string        `json:"systemMessage"`
+	Template           string        `json:"template"`
+	Raw                bool          `json:"raw"`
+	KeepAlive          string        `json:"keepAlive"`
+	Options            string        `json:"options"`
+	ResponseContent    string        `json:"responseContent"`
+	Context            string        `json:"context"`
+	TotalDuration      time.Duration `json:"totalDuration"`
+	LoadDuration       time.Duration `json:"loadDuration"`
+	PromptEvalCount    int           `json:"promptEvalCount"`
+	PromptEvalDuration time.Duration `json:"promptEvalDuration"`
+	EvalCount          int           `json:"evalCount"`
+	EvalDuration       time.Duration `json:"evalDuration"`
+	DoneReason         string        `json:"doneReason"`
+	IsSuccess          bool          `json:"isSuccess"`
+	Status             string        `json:"status"`
+	CreatedAt          time.Time     `json:"createdAt"`
+	UpdatedAt          time.Time     `json:"updatedAt"`
+}
+
+type CompletionRequest struct {
+	// 上一轮补全编号，不为空时使用其返回的上下文继续补全
+	ParentId      string `json:"parentId"`
+	ModelName     string `json:"modelName"`
+	Prompt        string `json:"prompt"`
+	Suffix        string `json:"suffix"`
+	SystemMessage string `json:"systemMessage"`
+	// 自定义提示词模板，为空时使用模型的模板
+	Template string `json:"template"`
+	// 为 true 时不使用模板，提示词原样发送给模型
+	Raw       bool   `json:"raw"`
+	KeepAlive string `json:"keepAlive"`
+	// 会话参数格式
+	Options string `json:"options"`
+}
+
+// StartCompletion 开始文本补全，补全内容以补全编号为事件名称按 ChatStreamDelta 格式流式返回
+func (c *Completion) StartCompletion(request *CompletionRequest) (*CompletionRunModel, error) {
+	if strings.TrimSpace(request.ModelName) == "" {
+		return nil, errors.New("model name is required")
+	}
+	if request.Prompt == "" {
+		return nil, errors.New("prompt is required")
+	}
+	var parentContext []int
+	if request.ParentId != "" {
+		parent, err := c.GetCompletion(request.ParentId)
+		if err != nil {
+			return nil, err
+		}
+		if parent.Status == messageStatusRunning {
+			return nil, errors.New("parent completion is running")
+		}
+		if parentContext, err = completionContext(parent); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	run := &CompletionRunModel{
+		Id:            uuid.NewString(),
+		ParentId:      request.ParentId,
+		ModelName:     strings.TrimSpace(request.ModelName),
+		Prompt:        request.Prompt,
+		Suffix:        request.Suffix,
+		SystemMessage: request.SystemMessage,
+		Template:      request.Template,
+		Raw:           request.Raw,
+		KeepAlive:     request.KeepAlive,
+		Options:       request.Options,
+		Status:        messageStatusRunning,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	generateRequest, err := completionRequest(run, parentContext)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.insertCompletion(run); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(app.ctx)
+	c.addCancel(run.Id, cancel)
+	go c.generate(ctx, run, generateRequest)
+	return run, nil
+}
+
+// 构建补全请求，tokens 为上一轮补全返回的上下文
+func completionRequest(run *CompletionRunModel, tokens []int) (*olm.GenerateRequest, error) {
+	options, err := sessionOptions(&SessionModel{Options: run.Options})
+	if err != nil {
+		return nil, err
+	}
+	request := &olm.GenerateRequest{
+		Model:    run.ModelName,
+		Prompt:   run.Prompt,
+		Suffix:   run.Suffix,
+		System:   run.SystemMessage,
+		Template: run.Template,
+		Context:  tokens,
+		Raw:      run.Raw,
+		Options:  options,
+	}
+	if run.KeepAlive != "" {
+		duration, err := time.ParseDuration(run.KeepAlive)
+		if err != nil {
+			return nil, err
+		}
+		request.KeepAlive = &olm.Duration{Duration: duration}
+	}
+	return request, nil
+}
+
+// 解析补全返回的上下文
+func completionContext(run *CompletionRunModel) ([]int, error) {
+	if run.Context == "" {
+		return nil, nil
+	}
+	var tokens []int
+	if err := json.Unmarshal([]byte(run.Context), &tokens); err != nil {
+		log.Error().Err(err).Str("id", run.Id).Msg("parse completion context error")
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (c *Completion) generate(ctx context.Context, run *CompletionRunModel, request *olm.GenerateRequest) {
+	defer c.removeCancel(run.Id)
+	defer c.finishCompletion(run)
+	log.Debug().Any("request", request).Msg("completion request")
+	stream := newChatStream(run.Id)
+	var buffer bytes.Buffer
+	err := ollama.newApiClient().Generate(ctx, request, func(response olm.GenerateResponse) error {
+		buffer.WriteString(response.Response)
+		if !response.Done {
+			stream.append(response.Response)
+			return nil
+		}
+		if len(response.Context) > 0 {
+			if data, err := json.Marshal(response.Context); err == nil {
+				run.Context = string(data)
+			}
+		}
+		metrics := response.Metrics
+		run.TotalDuration = metrics.TotalDuration
+		run.LoadDuration = metrics.LoadDuration
+		run.PromptEvalCount = metrics.PromptEvalCount
+		run.PromptEvalDuration = metrics.PromptEvalDuration
+		run.EvalCount = metrics.EvalCount
+		run.EvalDuration = metrics.EvalDuration
+		run.DoneReason = response.DoneReason
+		run.IsSuccess = true
+		run.ResponseContent = buffer.String()
+		run.UpdatedAt = response.CreatedAt
+		stream.finish(run.ResponseContent, true)
+		return nil
+	})
+	if err == nil {
+		return
+	}
+	run.UpdatedAt = time.Now()
+	if ctx.Err() != nil {
+		run.IsSuccess = true
+		run.DoneReason = doneReasonCanceled
+		run.ResponseContent = buffer.String()
+		stream.finish(run.ResponseContent, true)
+		return
+	}
+	log.Error().Err(err).Str("model", run.ModelName).Msg("completion error")
+	run.IsSuccess = false
+	run.DoneReason = err.Error()
+	run.ResponseContent = err.Error()
+	stream.finish(run.ResponseContent, false)
+}
+
+// StopCompletion 取消进行中的补全，已生成的内容会被保存
+func (c *Completion) StopCompletion(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cancel, ok := c.cancels[id]; ok {
+		cancel()
+	}
+}
+
+func (c *Completion) addCancel(id string, cancel context.CancelFunc) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.cancels == nil {
+		c.cancels = make(map[string]context.CancelFunc)
+	}
+	c.cancels[id] = cancel
+}
+
+func (c *Completion) removeCancel(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if cancel, ok := c.cancels[id]; ok {
+		cancel()
+		delete(c.cancels, id)
+	}
+}
+
+const completionColumns = `id, parent_id, model_name, prompt, suffix, system_message, template, raw, keep_alive, options,
+                 response_content, context, total_duration, load_duration, prompt_eval_count, prompt_eval_duration,
+                 eval_count, eval_duration, done_reason, is_success, status, created_at, updated_at`
+
+func (c *Completion) insertCompletion(run *CompletionRunModel) error {
+	sqlStr := `insert into t_completion_run(` + completionColumns + `)
+               values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, run.Id, run.ParentId, run.ModelName, run.Prompt, run.Suffix,
+		run.SystemMessage, run.Template, run.Raw, run.KeepAlive, run.Options, run.ResponseContent, run.Context,
+		run.TotalDuration, run.LoadDuration, run.PromptEvalCount, run.PromptEvalDuration, run.EvalCount, run.EvalDuration,
+		run.DoneReason, run.IsSuccess, run.Status, run.CreatedAt, run.UpdatedAt); err != nil {
+		log.Error().Err(err).Msg("create completion error")
+		return err
+	}
+	return nil
+}
+
+func (c *Completion) finishCompletion(run *CompletionRunModel) {
+	run.Status = messageStatusDone
+	sqlStr := `update t_completion_run set response_content = ?, context = ?, total_duration = ?, load_duration = ?,
+                   prompt_eval_count = ?, prompt_eval_duration = ?, eval_count = ?, eval_duration = ?, done_reason = ?,
+                   is_success = ?, status = ?, updated_at = ?
+               where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, run.ResponseContent, run.Context, run.TotalDuration,
+		run.LoadDuration, run.PromptEvalCount, run.PromptEvalDuration, run.EvalCount, run.EvalDuration, run.DoneReason,
+		run.IsSuccess, run.Status, run.UpdatedAt, run.Id); err != nil {
+		log.Error().Err(err).Msg("update completion error")
+	}
+	runtime.EventsEmit(app.ctx, eventCompletionDone, run)
+}
+
+// 将上次运行时未结束的补全标记为中断
+func (c *Completion) interruptRunningCompletions() error {
+	sqlStr := `update t_completion_run set status = ?, done_reason = ?, is_success = response_content != ''
+               where status = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, messageStatusInterrupted, messageStatusInterrupted,
+		messageStatusRunning); err != nil {
+		log.Error().Err(err).Msg("interrupt running completion error")
+		return err
+	}
+	return nil
+}
+
+func (c *Completion) scanCompletion(rows *sql.Rows) (*CompletionRunModel, error) {
+	run := &CompletionRunModel{}
+	if err := rows.Scan(&run.Id, &run.ParentId, &run.ModelName, &run.Prompt, &run.Suffix, &run.SystemMessage,
+		&run.Template, &run.Raw, &run.KeepAlive, &run.Options, &run.ResponseContent, &run.Context,
+		&run.TotalDuration, &run.LoadDuration, &run.PromptEvalCount, &run.PromptEvalDuration, &run.EvalCount,
+		&run.EvalDuration, &run.DoneReason, &run.IsSuccess, &run.Status, &run.CreatedAt, &run.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// Completions 查询补全记录，按创建时间倒序
+func (c *Completion) Completions() ([]*CompletionRunModel, error) {
+	sqlStr := `select ` + completionColumns + `
+            from t_completion_run
+            order by created_at desc`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr)
+	if err != nil {
+		log.Error().Err(err).Msg("query completion error")
+		return nil, err
+	}
+	defer rows.Close()
+	var runs []*CompletionRunModel
+	for rows.Next() {
+		run, err := c.scanCompletion(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill completion error")
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+func (c *Completion) GetCompletion(id string) (*CompletionRunModel, error) {
+	sqlStr := `select ` + completionColumns + `
+            from t_completion_run
+            where id = ?`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, id)
+	if err != nil {
+		log.Error().Err(err).Msg("query completion error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		run, err := c.scanCompletion(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill completion error")
+		}
+		return run, err
+	}
+	return nil, errors.New("completion not exists")
+}
+
+// DeleteCompletion 删除补全记录，以其为上一轮的补全保留内容但不再关联
+func (c *Completion) DeleteCompletion(id string) (string, error) {
+	return id, dao.transaction(func(tx *sql.Tx) error {
+		sqlStr := "delete from t_completion_run where id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete completion error")
+			return err
+		}
+		sqlStr = "update t_completion_run set parent_id = '' where parent_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("update completion parent error")
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,50 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompletionRequest(t *testing.T) {
+	run := &CompletionRunModel{
+		ModelName: "llama3",
+		Prompt:    "<|user|>hi",
+		Suffix:    "end",
+		Template:  "{{ .Prompt }}",
+		Raw:       true,
+		KeepAlive: "5m",
+		Options:   `{"version": 2, "values": {"temperature": 0.5}}`,
+	}
+	request, err := completionRequest(run, []int{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Model != "llama3" || request.Prompt != run.Prompt || request.Suffix != "end" || !request.Raw ||
+		request.Template != run.Template || !reflect.DeepEqual(request.Context, []int{1, 2, 3}) {
+		t.Errorf("unexpected request %+v", request)
+	}
+	if request.KeepAlive == nil || request.KeepAlive.Duration != 5*time.Minute {
+		t.Errorf("unexpected keep alive %v", request.KeepAlive)
+	}
+	if request.Options["temperature"] != 0.5 {
+		t.Errorf("unexpected options %v", request.Options)
+	}
+	run.KeepAlive = "forever"
+	if _, err := completionRequest(run, nil); err == nil {
+		t.Error("expected invalid keep alive error")
+	}
+}
+
+func TestCompletionContext(t *testing.T) {
+	if tokens, err := completionContext(&CompletionRunModel{}); err != nil || tokens != nil {
+		t.Errorf("expected empty context, got %v %v", tokens, err)
+	}
+	tokens, err := completionContext(&CompletionRunModel{Context: "[5,6]"})
+	if err != nil || !reflect.DeepEqual(tokens, []int{5, 6}) {
+		t.Errorf("unexpected context %v %v", tokens, err)
+	}
+	if _, err := completionContext(&CompletionRunModel{Context: "bad"}); err == nil {
+		t.Error("expected invalid context error")
+	}
+}
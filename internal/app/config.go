@@ -2,8 +2,10 @@ package app
 
 import (
 	"database/sql"
+	"errors"
 	"ollama-desktop/internal/config"
 	"ollama-desktop/internal/log"
+	"strconv"
 	"time"
 )
 
@@ -17,6 +19,16 @@ const (
 	configProxyPort     = "proxy.port"
 	configProxyUsername = "proxy.username"
 	configProxyPassword = "proxy.password"
+
+	configToolFileDir = "tool.file.dir"
+
+	configChatTitleModel = "chat.title.model"
+
+	configDownloadMaxConcurrent = "download.max.concurrent"
+	configDownloadMaxRetries    = "download.max.retries"
+
+	configRegistryUsername = "registry.username"
+	configRegistryPassword = "registry.password"
 )
 
 var configStore = Config{}
@@ -210,3 +222,118 @@ func (c *Config) SaveProxyConfigs(request *ProxyConfig) error {
 	c.configs(true)
 	return nil
 }
+
+type ToolConfig struct {
+	FileDir string `json:"fileDir"`
+}
+
+func (c *Config) ToolConfigs() (*ToolConfig, error) {
+	fileDir, err := c.get(configToolFileDir)
+	if err != nil {
+		return nil, err
+	}
+	return &ToolConfig{
+		FileDir: fileDir,
+	}, nil
+}
+
+func (c *Config) SaveToolConfigs(request *ToolConfig) error {
+	if err := c.set(configToolFileDir, request.FileDir); err != nil {
+		c.configs(true)
+		return err
+	}
+	c.configs(true)
+	return nil
+}
+
+type ChatConfig struct {
+	// 生成会话标题使用的模型，为空时使用会话模型
+	TitleModelName string `json:"titleModelName"`
+}
+
+func (c *Config) ChatConfigs() (*ChatConfig, error) {
+	titleModelName, err := c.get(configChatTitleModel)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatConfig{
+		TitleModelName: titleModelName,
+	}, nil
+}
+
+func (c *Config) SaveChatConfigs(request *ChatConfig) error {
+	if err := c.set(configChatTitleModel, request.TitleModelName); err != nil {
+		c.configs(true)
+		return err
+	}
+	c.configs(true)
+	return nil
+}
+
+type DownloadConfig struct {
+	// 同时下载的最大任务数量
+	MaxConcurrent int `json:"maxConcurrent"`
+	// 临时错误自动重试的最大次数，为 0 时不重试
+	MaxRetries int `json:"maxRetries"`
+}
+
+func (c *Config) DownloadConfigs() (*DownloadConfig, error) {
+	if _, err := c.configs(false); err != nil {
+		return nil, err
+	}
+	return &DownloadConfig{
+		MaxConcurrent: downloader.maxConcurrent(),
+		MaxRetries:    downloader.maxRetries(),
+	}, nil
+}
+
+func (c *Config) SaveDownloadConfigs(request *DownloadConfig) error {
+	if request.MaxConcurrent < 1 {
+		return errors.New("max concurrent must be greater than 0")
+	}
+	if request.MaxRetries < 0 {
+		return errors.New("max retries must not be negative")
+	}
+	if err := c.set(configDownloadMaxConcurrent, strconv.Itoa(request.MaxConcurrent)); err != nil {
+		c.configs(true)
+		return err
+	}
+	if err := c.set(configDownloadMaxRetries, strconv.Itoa(request.MaxRetries)); err != nil {
+		c.configs(true)
+		return err
+	}
+	c.configs(true)
+	// 调大并发数量后立即开始等待中的任务
+	go downloader.schedule()
+	return nil
+}
+
+type RegistryConfig struct {
+	// 推送模型使用的仓库账号
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (c *Config) RegistryConfigs() (*RegistryConfig, error) {
+	configs, err := c.configs(false)
+	if err != nil {
+		return nil, err
+	}
+	return &RegistryConfig{
+		Username: configs[configRegistryUsername],
+		Password: configs[configRegistryPassword],
+	}, nil
+}
+
+func (c *Config) SaveRegistryConfigs(request *RegistryConfig) error {
+	if err := c.set(configRegistryUsername, request.Username); err != nil {
+		c.configs(true)
+		return err
+	}
+	if err := c.set(configRegistryPassword, request.Password); err != nil {
+		c.configs(true)
+		return err
+	}
+	c.configs(true)
+	return nil
+}
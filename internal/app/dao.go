@@ -11,6 +11,9 @@ const (
 	messageRoleUser      = "user"
 	messageRoleSystem    = "system"
 	messageRoleAssistant = "assistant"
+
+	attachmentTypeImage    = "image"
+	attachmentTypeDocument = "document"
 )
 
 var dao = Dao{}
@@ -43,7 +46,8 @@ func (d *Dao) transaction(fn func(tx *sql.Tx) error) error {
 		return err
 	}
 	if err := fn(tx); err != nil {
-		return tx.Rollback()
+		tx.Rollback()
+		return err
 	}
 	return tx.Commit()
 }
@@ -58,18 +62,34 @@ type ConfigModel struct {
 type SessionModel struct {
 	Id                  string    `json:"id"`
 	SessionName         string    `json:"sessionName"`
+	NameSource          string    `json:"nameSource"` // 会话名称来源，手动输入的名称不会被自动生成的标题覆盖
 	ModelName           string    `json:"modelName"`
 	MessageHistoryCount int       `json:"messageHistoryCount"`
 	KeepAlive           string    `json:"keepAlive,omitempty"`
 	SystemMessage       string    `json:"systemMessage,omitempty"`
 	Options             string    `json:"options,omitempty"`
+	Tools               string    `json:"tools,omitempty"`
+	ActiveMessageId     string    `json:"activeMessageId"`
+	SummaryEnabled      bool      `json:"summaryEnabled"` // 是否启用历史摘要，超出历史消息窗口的问答会被合并到摘要中
+	SummaryModelName    string    `json:"summaryModelName,omitempty"`
+	Summary             string    `json:"summary,omitempty"`
+	SummaryMessageId    string    `json:"summaryMessageId,omitempty"`
+	ResponseFormat      string    `json:"responseFormat,omitempty"` // 结构化输出格式，json 或 JSON Schema
+	FormatRetries       int       `json:"formatRetries"`
+	KnowledgeBases      string    `json:"knowledgeBases,omitempty"` // 关联的知识库编号，json 数组
+	FolderId            string    `json:"folderId"`                 // 所属文件夹编号，为空表示未放入文件夹
+	Pinned              bool      `json:"pinned"`
+	Archived            bool      `json:"archived"`
 	CreatedAt           time.Time `json:"createdAt"`
 	UpdatedAt           time.Time `json:"updatedAt"`
+
+	Tags []string `json:"tags,omitempty"`
 }
 
 type ChatMessageModel struct {
 	Id                 string        `json:"id"`
 	SessionId          string        `json:"sessionId"`
+	ParentId           string        `json:"parentId"`
 	QuestionContent    string        `json:"questionContent"`
 	AnswerContent      string        `json:"answerContent"`
 	TotalDuration      time.Duration `json:"totalDuration"`
@@ -80,6 +100,73 @@ type ChatMessageModel struct {
 	EvalDuration       time.Duration `json:"evalDuration"`
 	DoneReason         string        `json:"doneReason"`
 	IsSuccess          bool          `json:"isSuccess"`
+	StructuredContent  string        `json:"structuredContent,omitempty"`
+	StructuredError    string        `json:"structuredError,omitempty"`
+	Status             string        `json:"status"`              // 回答状态：running、done、interrupted
+	Citations          string        `json:"citations,omitempty"` // 回答引用的知识库内容，json 数组
 	CreatedAt          time.Time     `json:"createdAt"`
 	UpdatedAt          time.Time     `json:"updatedAt"`
+
+	Images    []*ChatAttachmentModel `json:"images,omitempty"`
+	Documents []*ChatAttachmentModel `json:"documents,omitempty"`
+	ToolCalls []*ChatToolCallModel   `json:"toolCalls,omitempty"`
+}
+
+type ChatAttachmentModel struct {
+	Id             string    `json:"id"`
+	SessionId      string    `json:"sessionId"`
+	MessageId      string    `json:"messageId"`
+	AttachmentType string    `json:"attachmentType"`
+	FileName       string    `json:"fileName"`
+	MimeType       string    `json:"mimeType"`
+	Content        []byte    `json:"content"`
+	CreatedAt      time.Time `json:"createdAt"`
+	// 是否从数据库加载，请求中传入的附件始终为 false
+	stored bool
+}
+
+type ChatToolCallModel struct {
+	Id        string    `json:"id"`
+	SessionId string    `json:"sessionId"`
+	MessageId string    `json:"messageId"`
+	Round     int       `json:"round"`
+	ToolName  string    `json:"toolName"`
+	Arguments string    `json:"arguments"`
+	Result    string    `json:"result"`
+	IsSuccess bool      `json:"isSuccess"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type PromptTemplateModel struct {
+	Id           string    `json:"id"`
+	TemplateType string    `json:"templateType"`
+	Title        string    `json:"title"`
+	Description  string    `json:"description"`
+	Content      string    `json:"content"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+
+	// 模板中需要用户填写的变量，不包含内置变量
+	Variables []string `json:"variables,omitempty"`
+}
+
+type KnowledgeBaseModel struct {
+	Id             string    `json:"id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	EmbeddingModel string    `json:"embeddingModel"`
+	ChunkSize      int       `json:"chunkSize"`    // 分块长度，单位为字符
+	ChunkOverlap   int       `json:"chunkOverlap"` // 相邻分块重叠的字符数
+	TopK           int       `json:"topK"`         // 检索时返回的分块数量
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+type KnowledgeDocumentModel struct {
+	Id              string    `json:"id"`
+	KnowledgeBaseId string    `json:"knowledgeBaseId"`
+	FileName        string    `json:"fileName"`
+	ContentLength   int       `json:"contentLength"`
+	ChunkCount      int       `json:"chunkCount"`
+	CreatedAt       time.Time `json:"createdAt"`
 }
@@ -2,10 +2,12 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	ollama2 "ollama-desktop/internal/ollama"
 	"sort"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -23,24 +25,103 @@ const (
 	eventModelRefresh = "model_refresh"
 )
 
+// 下载任务状态
+const (
+	downloadStatusWaiting = "waiting"
+	downloadStatusRunning = "running"
+	downloadStatusPaused  = "paused"
+	downloadStatusError   = "error"
+	downloadStatusSuccess = "success"
+
+	// 任务类型：从仓库拉取模型、推送模型到仓库
+	downloadTaskPull = "pull"
+	downloadTaskPush = "push"
+
+	defaultMaxConcurrentPulls = 2
+)
+
 type DownloadItem struct {
-	Model    string `json:"model"`
+	Model string `json:"model"`
+	// 任务类型：pull、push
+	TaskType string `json:"taskType"`
 	Insecure bool   `json:"insecure,omitempty"`
+	// 任务状态：waiting、running、paused、error、success
+	Status string `json:"status"`
+	// 所有层合计的已下载及总字节数
+	Completed int64 `json:"completed"`
+	Total     int64 `json:"total"`
+	// 平滑后的下载速度，字节/秒
+	Speed float64 `json:"speed"`
+	// 预计剩余时间，单位秒，无法估算时为 0
+	Eta   int64  `json:"eta"`
+	Error string `json:"error,omitempty"`
+	// 当前为第几次下载及最多下载次数，临时错误会自动重试
+	Attempt     int `json:"attempt"`
+	MaxAttempts int `json:"maxAttempts"`
+	// 等待重试时下次重试的时间
+	RetryAt   *time.Time `json:"retryAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	// 优先级，越大越先下载
+	Priority int `json:"priority"`
+	// 排队顺序，同一优先级中越小越先下载
+	Sequence int64 `json:"sequence"`
+	// 等待中的任务在队列中的位置，从 1 开始，其他状态为 0
+	Position int `json:"position"`
 	// 进度条数据
 	Bars     []*ProgressBar     `json:"bars"`
 	Canceled bool               `json:"-"`
 	cancel   context.CancelFunc `json:"-"`
+	// 是否正在下载
+	running bool
+	// 是否被暂停，暂停的任务取消下载后保留
+	paused bool
+	// 是否已从数据库删除，删除后不再保存，避免已结束的任务被重新写入
+	removed bool
+	rate    transferRate
+}
+
+// 更新模型整体的下载速度及剩余时间
+func (i *DownloadItem) measure(now time.Time) {
+	i.Speed = i.rate.update(i.Completed, now)
+	i.Eta = estimateSeconds(i.Completed, i.Total, i.Speed)
+}
+
+// 下载结束时清空速度
+func (i *DownloadItem) idle() {
+	i.rate.reset()
+	i.Speed, i.Eta = 0, 0
 }
 
 type ProgressBar struct {
 	Name       string  `json:"name"`
 	Percentage float64 `json:"percentage"`
 	Status     string  `json:"status"`
+	// 该层的已下载及总字节数、下载速度（字节/秒）及预计剩余时间（秒）
+	Completed int64   `json:"completed"`
+	Total     int64   `json:"total"`
+	Speed     float64 `json:"speed"`
+	Eta       int64   `json:"eta"`
+	rate      transferRate
 }
 
 func (p *ProgressBar) stop() {
 	p.Status = "success"
 	p.Percentage = 100
+	p.Speed, p.Eta = 0, 0
+}
+
+// 更新该层的字节进度、速度及剩余时间
+func (p *ProgressBar) progress(completed, total int64, now time.Time) {
+	p.Completed, p.Total = completed, total
+	if total > 0 {
+		p.set(float64(completed) / float64(total) * 100)
+	}
+	if p.Status == "success" {
+		p.Speed, p.Eta = 0, 0
+		return
+	}
+	p.Speed = p.rate.update(completed, now)
+	p.Eta = estimateSeconds(completed, total, p.Speed)
 }
 
 func (p *ProgressBar) set(percentage float64) {
@@ -52,40 +133,212 @@ func (p *ProgressBar) set(percentage float64) {
 	}
 }
 
+// DownLoader 模型下载及推送，任务保存在数据库中，程序重启后继续未完成的任务
+// 任务按优先级及排队顺序依次执行，同时执行的数量不超过配置的最大值
 type DownLoader struct {
 	tasks map[string]*DownloadItem
-	lock  sync.Mutex
+	// 最大的排队顺序
+	sequence int64
+	lock     sync.Mutex
+	// 保证任务的保存及删除按顺序执行，需在 lock 之前获取
+	store sync.Mutex
+}
+
+// 加载上次运行时未完成的下载任务，进行中的任务在 ollama 服务可用后继续下载
+func (d *DownLoader) startup() {
+	items, err := d.loadTasks()
+	if err != nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.tasks == nil {
+		d.tasks = make(map[string]*DownloadItem)
+	}
+	for _, item := range items {
+		if item.TaskType == "" {
+			item.TaskType = downloadTaskPull
+		}
+		if item.Status == downloadStatusRunning || item.Status == downloadStatusSuccess {
+			item.Status = downloadStatusWaiting
+		}
+		d.tasks[item.Model] = item
+		if item.Sequence > d.sequence {
+			d.sequence = item.Sequence
+		}
+	}
 }
 
 func (d *DownLoader) Pull(request *ollama2.PullRequest) error {
 	if request.Model == "" && request.Name != "" {
 		request.Model = request.Name
 	}
+	if request.Model == "" {
+		return errors.New("model is required")
+	}
+	return d.add(request.Model, downloadTaskPull, request.Insecure)
+}
+
+// 添加任务到等待队列，同一模型同时只能有一个任务
+func (d *DownLoader) add(model, taskType string, insecure bool) error {
+	d.lock.Lock()
 	if d.tasks == nil {
 		d.tasks = make(map[string]*DownloadItem)
 	}
-	if _, ok := d.tasks[request.Model]; ok {
+	item, ok := d.tasks[model]
+	if ok && item.running {
+		d.lock.Unlock()
+		if item.TaskType != taskType {
+			return errors.New("model has a running task")
+		}
 		return nil
 	}
-	item := &DownloadItem{
-		Model:    request.Model,
-		Insecure: request.Insecure,
-		Bars:     nil,
+	if !ok {
+		d.sequence++
+		item = &DownloadItem{
+			Model:     model,
+			CreatedAt: time.Now(),
+			Sequence:  d.sequence,
+		}
+		d.tasks[model] = item
 	}
-	d.tasks[request.Model] = item
-	go d.pull(request, item)
+	item.TaskType = taskType
+	item.Insecure = insecure
+	d.enqueue(item)
 	return nil
 }
 
-func (d *DownLoader) pull(request *ollama2.PullRequest, item *DownloadItem) {
+// 任务加入等待队列并保存后开始调度，调用时需持有锁，返回前释放锁
+// 任务在返回前已保存，程序随后退出时任务不会丢失
+func (d *DownLoader) enqueue(item *DownloadItem) {
+	item.Status = downloadStatusWaiting
+	item.Error = ""
+	item.Canceled = false
+	item.removed = false
+	d.lock.Unlock()
+	d.persist(item)
+	d.emit(pullStatusWait, item)
+	d.schedule()
+}
+
+// 开始下载任务，调用时需持有锁
+func (d *DownLoader) start(item *DownloadItem) {
 	ctx, cancel := context.WithCancel(app.ctx)
 	item.cancel = cancel
+	item.running = true
+	item.paused = false
+	item.Canceled = false
+	item.Status = downloadStatusRunning
+	item.Error = ""
+	item.Bars = nil
+	item.idle()
+	go d.pull(ctx, item)
+}
+
+// 按队列顺序开始等待中的任务，直到达到最大同时下载数量
+func (d *DownLoader) schedule() {
+	limit := d.maxConcurrent()
+	d.lock.Lock()
+	var items []*DownloadItem
+	for _, item := range d.tasks {
+		items = append(items, item)
+	}
+	next := nextDownloads(items, limit)
+	for _, item := range next {
+		d.start(item)
+	}
+	d.lock.Unlock()
+	if len(next) > 0 {
+		runtime.EventsEmit(app.ctx, pullEventList, d.List())
+	}
+}
+
+func (d *DownLoader) maxConcurrent() int {
+	value, _ := configStore.get(configDownloadMaxConcurrent)
+	if limit, err := strconv.Atoi(value); err == nil && limit > 0 {
+		return limit
+	}
+	return defaultMaxConcurrentPulls
+}
+
+// 队列中接下来需要开始的任务
+func nextDownloads(items []*DownloadItem, limit int) []*DownloadItem {
+	running := 0
+	for _, item := range items {
+		if item.running {
+			running++
+		}
+	}
+	var next []*DownloadItem
+	for _, item := range sortDownloads(items) {
+		if running >= limit {
+			break
+		}
+		if item.Status == downloadStatusWaiting && !item.running {
+			next = append(next, item)
+			running++
+		}
+	}
+	return next
+}
+
+// 按队列顺序排序：下载中的任务在前，其次为等待中的任务，最后为暂停及失败的任务
+// 等待中的任务按优先级从高到低排序，优先级相同时按排队顺序排序，并更新任务在队列中的位置
+func sortDownloads(items []*DownloadItem) []*DownloadItem {
+	rank := func(item *DownloadItem) int {
+		switch {
+		case item.running || item.Status == downloadStatusRunning || item.Status == downloadStatusSuccess:
+			return 0
+		case item.Status == downloadStatusWaiting:
+			return 1
+		case item.Status == downloadStatusPaused:
+			return 2
+		}
+		return 3
+	}
+	sorted := append([]*DownloadItem(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := rank(sorted[i]), rank(sorted[j])
+		if ri != rj {
+			return ri < rj
+		}
+		if ri == 1 && sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority > sorted[j].Priority
+		}
+		if sorted[i].Sequence != sorted[j].Sequence {
+			return sorted[i].Sequence < sorted[j].Sequence
+		}
+		return sorted[i].Model < sorted[j].Model
+	})
+	position := 0
+	for _, item := range sorted {
+		item.Position = 0
+		if rank(item) == 1 {
+			position++
+			item.Position = position
+		}
+	}
+	return sorted
+}
+
+func (d *DownLoader) pull(ctx context.Context, item *DownloadItem) {
+	maxAttempts := d.maxRetries() + 1
+	d.lock.Lock()
+	item.Attempt = 1
+	item.MaxAttempts = maxAttempts
+	item.RetryAt = nil
+	d.lock.Unlock()
+	d.persist(item)
 	d.emit(pullStatusWait, item)
 
 	cache := make(map[string]*ProgressBar)
+	// 各层的下载字节数，ollama 重新下载时会跳过已下载的部分
+	layers := make(map[string]ollama2.ProgressResponse)
 	var status string
 	var spinner *ProgressBar
-	err := ollama.newApiClient().Pull(ctx, request, func(resp ollama2.ProgressResponse) error {
+	lastCheckpoint := time.Now()
+	progress := func(resp ollama2.ProgressResponse) error {
+		d.lock.Lock()
 		if resp.Digest != "" {
 			if spinner != nil {
 				spinner.stop()
@@ -93,15 +346,22 @@ func (d *DownLoader) pull(request *ollama2.PullRequest, item *DownloadItem) {
 			bar, ok := cache[resp.Digest]
 			if !ok {
 				bar = &ProgressBar{
-					Name:       fmt.Sprintf("pulling %s", resp.Digest[7:19]),
+					Name:       fmt.Sprintf("%sing %s", item.TaskType, shortDigest(resp.Digest)),
 					Percentage: 0,
 					Status:     "",
 				}
 				item.Bars = append(item.Bars, bar)
 				cache[resp.Digest] = bar
 			}
-			percentage := float64(resp.Completed) / float64(resp.Total) * 100
-			bar.set(percentage)
+			now := time.Now()
+			bar.progress(resp.Completed, resp.Total, now)
+			layers[resp.Digest] = resp
+			item.Completed, item.Total = 0, 0
+			for _, layer := range layers {
+				item.Completed += layer.Completed
+				item.Total += layer.Total
+			}
+			item.measure(now)
 		} else if status != resp.Status {
 			if spinner != nil {
 				spinner.stop()
@@ -116,70 +376,240 @@ func (d *DownLoader) pull(request *ollama2.PullRequest, item *DownloadItem) {
 			}
 			item.Bars = append(item.Bars, spinner)
 		}
+		checkpoint := time.Since(lastCheckpoint) >= checkpointInterval
+		d.lock.Unlock()
+		if checkpoint {
+			lastCheckpoint = time.Now()
+			d.persist(item)
+		}
 		d.emit(pullStatusPulling, item)
 		return nil
-	})
-
-	if err != nil {
-		delete(d.tasks, request.Model)
-		if !item.Canceled {
-			d.emit(pullStatusError, item)
-		} else {
-			d.emit(pullStatusPulling, item)
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		// ollama 重新下载或推送时会跳过已完成的部分
+		err = d.transfer(ctx, item, progress)
+		if err == nil || ctx.Err() != nil || !d.retry(ctx, item, attempt, err) {
+			break
 		}
-	} else {
+	}
+
+	d.lock.Lock()
+	item.running = false
+	item.cancel = nil
+	item.RetryAt = nil
+	item.idle()
+	for _, bar := range item.Bars {
+		bar.Speed, bar.Eta = 0, 0
+	}
+	switch {
+	case item.Canceled:
+		delete(d.tasks, item.Model)
+		item.removed = true
+		d.lock.Unlock()
+		d.deleteTask(item)
+		d.emit(pullStatusPulling, item)
+		d.schedule()
+	case item.paused:
+		item.Status = downloadStatusPaused
+		d.lock.Unlock()
+		d.persist(item)
+		d.emit(pullStatusPulling, item)
+		d.schedule()
+	case err != nil:
+		item.Status = downloadStatusError
+		item.Error = err.Error()
+		d.lock.Unlock()
+		d.persist(item)
+		d.emit(pullStatusError, item)
+		d.schedule()
+	default:
+		item.Status = downloadStatusSuccess
 		if spinner != nil {
 			spinner.stop()
 		}
+		item.removed = true
+		d.lock.Unlock()
+		d.deleteTask(item)
 		d.emit(pullStatusPulling, item)
+		// 空出的位置由等待中的任务补上
+		d.schedule()
 
 		<-time.After(2 * time.Second)
 
-		delete(d.tasks, request.Model)
-		if !item.Canceled {
-			d.emit(pullStatusSuccess, item)
-		} else {
-			d.emit(pullStatusPulling, item)
-		}
+		d.clean(item)
+		d.emit(pullStatusSuccess, item)
 	}
 }
 
-func (d *DownLoader) emit(status int, item *DownloadItem) {
+// 从列表中移除已完成的任务，等待期间重新加入队列的任务保留
+func (d *DownLoader) clean(item *DownloadItem) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
+	if current, ok := d.tasks[item.Model]; ok && current == item && item.Status == downloadStatusSuccess {
+		delete(d.tasks, item.Model)
+	}
+}
+
+// 按任务类型拉取或推送模型
+func (d *DownLoader) transfer(ctx context.Context, item *DownloadItem, fn func(ollama2.ProgressResponse) error) error {
+	client := ollama.newApiClient()
+	if item.TaskType == downloadTaskPush {
+		return client.Push(ctx, d.pushRequest(item), fn)
+	}
+	return client.Pull(ctx, &ollama2.PullRequest{
+		Model:    item.Model,
+		Insecure: item.Insecure,
+	}, fn)
+}
+
+func shortDigest(digest string) string {
+	if len(digest) >= 19 {
+		return digest[7:19]
+	}
+	return digest
+}
+
+func (d *DownLoader) emit(status int, item *DownloadItem) {
 	runtime.EventsEmit(app.ctx, pullEventList, d.List())
 	switch status {
 	case pullStatusSuccess:
 		runtime.EventsEmit(app.ctx, pullEventSuccess, item)
-		runtime.EventsEmit(app.ctx, eventModelRefresh)
+		if item.TaskType == downloadTaskPull {
+			runtime.EventsEmit(app.ctx, eventModelRefresh)
+		}
 	case pullStatusError:
 		runtime.EventsEmit(app.ctx, pullEventError, item)
 	}
 }
 
-func (d *DownLoader) Cancel(model string) {
-	if d.tasks == nil {
-		return
+// Pause 暂停下载，已下载的部分由 ollama 保留，继续下载时跳过
+func (d *DownLoader) Pause(model string) error {
+	d.lock.Lock()
+	item, ok := d.tasks[model]
+	if !ok {
+		d.lock.Unlock()
+		return errors.New("download task not exists")
+	}
+	if item.running {
+		item.paused = true
+		item.cancel()
+		d.lock.Unlock()
+		return nil
+	}
+	if item.Status == downloadStatusWaiting || item.Status == downloadStatusError {
+		item.Status = downloadStatusPaused
+	}
+	d.lock.Unlock()
+	d.persist(item)
+	d.emit(pullStatusPulling, item)
+	return nil
+}
+
+// Resume 继续暂停或失败的下载，任务重新加入等待队列
+func (d *DownLoader) Resume(model string) error {
+	d.lock.Lock()
+	item, ok := d.tasks[model]
+	if !ok {
+		d.lock.Unlock()
+		return errors.New("download task not exists")
+	}
+	if item.running || item.Status == downloadStatusWaiting {
+		d.lock.Unlock()
+		return nil
+	}
+	d.enqueue(item)
+	return nil
+}
+
+// SetPriority 设置任务优先级，等待中的任务按优先级从高到低开始下载
+func (d *DownLoader) SetPriority(model string, priority int) error {
+	d.lock.Lock()
+	item, ok := d.tasks[model]
+	if !ok {
+		d.lock.Unlock()
+		return errors.New("download task not exists")
+	}
+	item.Priority = priority
+	d.lock.Unlock()
+	d.persist(item)
+	d.emit(pullStatusWait, item)
+	d.schedule()
+	return nil
+}
+
+// ReorderDownloads 按给定的模型顺序调整等待中任务的排队顺序，优先级不变
+// 未包含的等待中任务保持原有顺序排在后面
+func (d *DownLoader) ReorderDownloads(models []string) error {
+	d.lock.Lock()
+	var items []*DownloadItem
+	for _, item := range d.tasks {
+		items = append(items, item)
+	}
+	reordered := reorderDownloads(items, models)
+	for _, item := range reordered {
+		d.sequence++
+		item.Sequence = d.sequence
 	}
-	if item, ok := d.tasks[model]; ok {
-		if item.cancel != nil {
-			item.Canceled = true
-			item.cancel()
+	d.lock.Unlock()
+	for _, item := range reordered {
+		d.persist(item)
+	}
+	runtime.EventsEmit(app.ctx, pullEventList, d.List())
+	d.schedule()
+	return nil
+}
+
+// 按给定顺序排列等待中的任务，返回重新排列后的全部等待中任务
+func reorderDownloads(items []*DownloadItem, models []string) []*DownloadItem {
+	waiting := make(map[string]*DownloadItem)
+	var rest []*DownloadItem
+	for _, item := range sortDownloads(items) {
+		if item.Status == downloadStatusWaiting && !item.running {
+			waiting[item.Model] = item
+			rest = append(rest, item)
+		}
+	}
+	var reordered []*DownloadItem
+	for _, model := range models {
+		if item, ok := waiting[model]; ok {
+			reordered = append(reordered, item)
+			delete(waiting, model)
+		}
+	}
+	for _, item := range rest {
+		if _, ok := waiting[item.Model]; ok {
+			reordered = append(reordered, item)
 		}
 	}
+	return reordered
+}
+
+func (d *DownLoader) Cancel(model string) {
+	d.lock.Lock()
+	item, ok := d.tasks[model]
+	running := ok && item.running
+	if running {
+		item.Canceled = true
+		item.cancel()
+	} else if ok {
+		// 未在下载的任务直接删除
+		delete(d.tasks, model)
+		item.removed = true
+	}
+	d.lock.Unlock()
+	if ok && !running {
+		d.deleteTask(item)
+	}
 	runtime.EventsEmit(app.ctx, pullEventList, d.List())
 }
 
 func (d *DownLoader) List() []*DownloadItem {
-	if d.tasks == nil {
-		return nil
-	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	var list []*DownloadItem
 	for _, item := range d.tasks {
 		list = append(list, item)
 	}
-	sort.Slice(list, func(i, j int) bool {
-		return list[i].Model < list[j].Model
-	})
-	return list
+	return sortDownloads(list)
 }
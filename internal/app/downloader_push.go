@@ -0,0 +1,39 @@
+package app
+
+import (
+	"errors"
+	ollama2 "ollama-desktop/internal/ollama"
+)
+
+// Push 推送模型到仓库，与下载共用任务队列，进度及错误通过下载事件通知
+// 请求中携带的仓库账号保存到配置中，未携带时使用已保存的账号
+func (d *DownLoader) Push(request *ollama2.PushRequest) error {
+	if request.Model == "" && request.Name != "" {
+		request.Model = request.Name
+	}
+	if request.Model == "" {
+		return errors.New("model is required")
+	}
+	if request.Username != "" {
+		if err := configStore.SaveRegistryConfigs(&RegistryConfig{
+			Username: request.Username,
+			Password: request.Password,
+		}); err != nil {
+			return err
+		}
+	}
+	return d.add(request.Model, downloadTaskPush, request.Insecure)
+}
+
+// 推送请求，账号从配置中读取，避免保存在任务中
+func (d *DownLoader) pushRequest(item *DownloadItem) *ollama2.PushRequest {
+	request := &ollama2.PushRequest{
+		Model:    item.Model,
+		Insecure: item.Insecure,
+	}
+	if registry, err := configStore.RegistryConfigs(); err == nil {
+		request.Username = registry.Username
+		request.Password = registry.Password
+	}
+	return request
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// 计算下载速度的最小采样间隔，间隔过短时瞬时速度波动较大
+	rateSampleInterval = 500 * time.Millisecond
+	// 指数平滑系数，越大越接近最近一次采样的速度
+	rateSmoothing = 0.3
+)
+
+// 下载速度统计，使用指数移动平均平滑速度
+type transferRate struct {
+	// 上次采样的字节数及时间
+	bytes int64
+	time  time.Time
+	// 平滑后的速度，字节/秒
+	rate float64
+}
+
+// 记录当前已下载的字节数，返回平滑后的速度
+func (r *transferRate) update(bytes int64, now time.Time) float64 {
+	// 首次采样或字节数回退（重新下载）时重新开始统计
+	if r.time.IsZero() || bytes < r.bytes {
+		r.bytes, r.time, r.rate = bytes, now, 0
+		return r.rate
+	}
+	elapsed := now.Sub(r.time)
+	if elapsed < rateSampleInterval {
+		return r.rate
+	}
+	current := float64(bytes-r.bytes) / elapsed.Seconds()
+	if r.rate == 0 {
+		r.rate = current
+	} else {
+		r.rate = rateSmoothing*current + (1-rateSmoothing)*r.rate
+	}
+	r.bytes, r.time = bytes, now
+	return r.rate
+}
+
+func (r *transferRate) reset() {
+	*r = transferRate{}
+}
+
+// 按当前速度估算剩余时间，单位秒，无法估算时返回 0
+func estimateSeconds(completed, total int64, rate float64) int64 {
+	if rate <= 0 || total <= completed {
+		return 0
+	}
+	return int64(math.Ceil(float64(total-completed) / rate))
+}
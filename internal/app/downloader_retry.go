@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"ollama-desktop/internal/log"
+	ollama2 "ollama-desktop/internal/ollama"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxPullRetries = 3
+	// 首次重试的等待时间，之后每次翻倍
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = time.Minute
+)
+
+// 不需要重试的错误，如模型不存在、未授权等
+var permanentPullErrors = []string{
+	"file does not exist",
+	"not found",
+	"manifest unknown",
+	"unauthorized",
+	"forbidden",
+	"invalid",
+	"insecure protocol",
+	"no space left",
+}
+
+// 可以重试的错误，如连接断开、超时、仓库服务异常等
+var transientPullErrors = []string{
+	"eof",
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"timeout",
+	"timed out",
+	"temporary",
+	"no such host",
+	"max retries exceeded",
+	"too many requests",
+	"internal server error",
+	"bad gateway",
+	"service unavailable",
+	"gateway timeout",
+}
+
+// 判断下载错误是否为临时错误，临时错误可以重试
+func transientPullError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusError ollama2.StatusError
+	if errors.As(err, &statusError) {
+		return retryableStatus(statusError.StatusCode)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netError net.Error
+	if errors.As(err, &netError) {
+		return true
+	}
+	// ollama 通过流返回的错误只有文本，根据错误信息判断
+	message := strings.ToLower(err.Error())
+	for _, permanent := range permanentPullErrors {
+		if strings.Contains(message, permanent) {
+			return false
+		}
+	}
+	for _, transient := range transientPullErrors {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	for _, code := range []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout} {
+		if strings.Contains(message, strconv.Itoa(code)) {
+			return true
+		}
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// 第 attempt 次失败后重试前的等待时间
+func retryBackoff(attempt int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+func (d *DownLoader) maxRetries() int {
+	value, _ := configStore.get(configDownloadMaxRetries)
+	if retries, err := strconv.Atoi(value); err == nil && retries >= 0 {
+		return retries
+	}
+	return defaultMaxPullRetries
+}
+
+// 第 attempt 次下载失败后，临时错误等待一段时间后重试，返回是否需要重试
+func (d *DownLoader) retry(ctx context.Context, item *DownloadItem, attempt int, err error) bool {
+	if attempt >= item.MaxAttempts || !transientPullError(err) {
+		return false
+	}
+	delay := retryBackoff(attempt)
+	retryAt := time.Now().Add(delay)
+	log.Warn().Err(err).Str("model", item.Model).Int("attempt", attempt).Dur("delay", delay).Msg("pull model retry")
+
+	d.lock.Lock()
+	item.Error = err.Error()
+	item.RetryAt = &retryAt
+	item.idle()
+	d.lock.Unlock()
+	d.emit(pullStatusPulling, item)
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(delay):
+	}
+	d.lock.Lock()
+	item.Attempt = attempt + 1
+	item.Error = ""
+	item.RetryAt = nil
+	d.lock.Unlock()
+	d.emit(pullStatusPulling, item)
+	return true
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"ollama-desktop/internal/log"
+	"time"
+)
+
+// 保存到数据库的任务数据，持有锁时从 DownloadItem 复制，避免保存时读取下载中修改的字段
+type downloadTask struct {
+	model     string
+	taskType  string
+	insecure  bool
+	status    string
+	completed int64
+	total     int64
+	error     string
+	priority  int
+	sequence  int64
+	createdAt time.Time
+}
+
+// 复制任务当前的状态，调用时需持有锁
+func (i *DownloadItem) snapshot() *downloadTask {
+	return &downloadTask{
+		model:     i.Model,
+		taskType:  i.TaskType,
+		insecure:  i.Insecure,
+		status:    i.Status,
+		completed: i.Completed,
+		total:     i.Total,
+		error:     i.Error,
+		priority:  i.Priority,
+		sequence:  i.Sequence,
+		createdAt: i.CreatedAt,
+	}
+}
+
+// 保存任务的最新状态，已删除的任务不再保存，调用时不能持有锁
+func (d *DownLoader) persist(item *DownloadItem) {
+	d.store.Lock()
+	defer d.store.Unlock()
+	d.lock.Lock()
+	removed := item.removed
+	task := item.snapshot()
+	d.lock.Unlock()
+	if !removed {
+		d.saveTask(task)
+	}
+}
+
+// 保存下载任务的状态及进度
+func (d *DownLoader) saveTask(task *downloadTask) {
+	sqlStr := `insert into t_download_task(model_name, task_type, insecure, status, completed, total, error_message,
+                   priority, sequence, created_at, updated_at)
+               values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+               on conflict(model_name) do update set task_type = excluded.task_type, insecure = excluded.insecure,
+                   status = excluded.status, completed = excluded.completed, total = excluded.total,
+                   error_message = excluded.error_message, priority = excluded.priority, sequence = excluded.sequence,
+                   updated_at = excluded.updated_at`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, task.model, task.taskType, task.insecure, task.status,
+		task.completed, task.total, task.error, task.priority, task.sequence, task.createdAt, time.Now()); err != nil {
+		log.Error().Err(err).Str("model", task.model).Msg("save download task error")
+	}
+}
+
+// 删除下载任务，调用前需在持有锁时将任务标记为已删除，调用时不能持有锁
+// 删除前任务重新加入队列时不再删除
+func (d *DownLoader) deleteTask(item *DownloadItem) {
+	d.store.Lock()
+	defer d.store.Unlock()
+	d.lock.Lock()
+	removed := item.removed
+	d.lock.Unlock()
+	if !removed {
+		return
+	}
+	sqlStr := `delete from t_download_task where model_name = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, item.Model); err != nil {
+		log.Error().Err(err).Str("model", item.Model).Msg("delete download task error")
+	}
+}
+
+func (d *DownLoader) loadTasks() ([]*DownloadItem, error) {
+	sqlStr := `select model_name, task_type, insecure, status, completed, total, error_message, priority, sequence, created_at
+            from t_download_task
+            order by sequence, created_at`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr)
+	if err != nil {
+		log.Error().Err(err).Msg("query download task error")
+		return nil, err
+	}
+	defer rows.Close()
+	var items []*DownloadItem
+	for rows.Next() {
+		item := &DownloadItem{}
+		if err := rows.Scan(&item.Model, &item.TaskType, &item.Insecure, &item.Status, &item.Completed, &item.Total,
+			&item.Error, &item.Priority, &item.Sequence, &item.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("fill download task error")
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
@@ -0,0 +1,210 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	ollama2 "ollama-desktop/internal/ollama"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func downloadModels(items []*DownloadItem) []string {
+	var models []string
+	for _, item := range items {
+		models = append(models, item.Model)
+	}
+	return models
+}
+
+func TestSortDownloads(t *testing.T) {
+	items := []*DownloadItem{
+		{Model: "error", Status: downloadStatusError, Sequence: 1},
+		{Model: "paused", Status: downloadStatusPaused, Sequence: 2},
+		{Model: "low", Status: downloadStatusWaiting, Sequence: 3},
+		{Model: "high", Status: downloadStatusWaiting, Sequence: 6, Priority: 1},
+		{Model: "running", Status: downloadStatusRunning, Sequence: 5, running: true},
+		{Model: "early", Status: downloadStatusWaiting, Sequence: 4},
+	}
+	sorted := sortDownloads(items)
+	if expected := []string{"running", "high", "low", "early", "paused", "error"}; !reflect.DeepEqual(downloadModels(sorted), expected) {
+		t.Errorf("expected %v, got %v", expected, downloadModels(sorted))
+	}
+	var positions []int
+	for _, item := range sorted {
+		positions = append(positions, item.Position)
+	}
+	if expected := []int{0, 1, 2, 3, 0, 0}; !reflect.DeepEqual(positions, expected) {
+		t.Errorf("expected positions %v, got %v", expected, positions)
+	}
+}
+
+func TestNextDownloads(t *testing.T) {
+	items := []*DownloadItem{
+		{Model: "running", Status: downloadStatusRunning, running: true},
+		{Model: "a", Status: downloadStatusWaiting, Sequence: 2},
+		{Model: "b", Status: downloadStatusWaiting, Sequence: 1},
+		{Model: "paused", Status: downloadStatusPaused},
+	}
+	if next := nextDownloads(items, 2); !reflect.DeepEqual(downloadModels(next), []string{"b"}) {
+		t.Errorf("unexpected next downloads %v", downloadModels(next))
+	}
+	if next := nextDownloads(items, 5); !reflect.DeepEqual(downloadModels(next), []string{"b", "a"}) {
+		t.Errorf("unexpected next downloads %v", downloadModels(next))
+	}
+	if next := nextDownloads(items, 1); len(next) != 0 {
+		t.Errorf("unexpected next downloads %v", downloadModels(next))
+	}
+}
+
+func TestReorderDownloads(t *testing.T) {
+	items := []*DownloadItem{
+		{Model: "a", Status: downloadStatusWaiting, Sequence: 1},
+		{Model: "b", Status: downloadStatusWaiting, Sequence: 2},
+		{Model: "c", Status: downloadStatusWaiting, Sequence: 3},
+		{Model: "running", Status: downloadStatusRunning, running: true},
+	}
+	reordered := reorderDownloads(items, []string{"c", "running", "missing"})
+	if expected := []string{"c", "a", "b"}; !reflect.DeepEqual(downloadModels(reordered), expected) {
+		t.Errorf("expected %v, got %v", expected, downloadModels(reordered))
+	}
+}
+
+func TestTransferRate(t *testing.T) {
+	start := time.Unix(0, 0)
+	var rate transferRate
+	if speed := rate.update(1000, start); speed != 0 {
+		t.Errorf("expected no speed on first sample, got %v", speed)
+	}
+	if speed := rate.update(1100, start.Add(100*time.Millisecond)); speed != 0 {
+		t.Errorf("expected sample skipped, got %v", speed)
+	}
+	if speed := rate.update(2000, start.Add(time.Second)); speed != 1000 {
+		t.Errorf("expected 1000, got %v", speed)
+	}
+	// 0.3 * 2000 + 0.7 * 1000
+	if speed := rate.update(4000, start.Add(2*time.Second)); speed != 1300 {
+		t.Errorf("expected 1300, got %v", speed)
+	}
+	if speed := rate.update(10, start.Add(3*time.Second)); speed != 0 {
+		t.Errorf("expected reset when bytes go back, got %v", speed)
+	}
+}
+
+func TestEstimateSeconds(t *testing.T) {
+	for _, c := range []struct {
+		completed, total int64
+		rate             float64
+		expected         int64
+	}{
+		{0, 1000, 0, 0},
+		{1000, 1000, 10, 0},
+		{100, 1000, 300, 3},
+		{400, 1000, 300, 2},
+	} {
+		if eta := estimateSeconds(c.completed, c.total, c.rate); eta != c.expected {
+			t.Errorf("estimateSeconds(%d, %d, %v) expected %d, got %d", c.completed, c.total, c.rate, c.expected, eta)
+		}
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	start := time.Unix(0, 0)
+	bar := &ProgressBar{}
+	bar.progress(0, 4000, start)
+	bar.progress(1000, 4000, start.Add(time.Second))
+	if bar.Percentage != 25 || bar.Completed != 1000 || bar.Total != 4000 || bar.Speed != 1000 || bar.Eta != 3 {
+		t.Errorf("unexpected progress %+v", bar)
+	}
+	bar.progress(4000, 4000, start.Add(2*time.Second))
+	if bar.Status != "success" || bar.Speed != 0 || bar.Eta != 0 {
+		t.Errorf("unexpected finished progress %+v", bar)
+	}
+}
+
+func TestTransientPullError(t *testing.T) {
+	for _, c := range []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{io.ErrUnexpectedEOF, true},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, true},
+		{ollama2.StatusError{StatusCode: http.StatusBadGateway}, true},
+		{ollama2.StatusError{StatusCode: http.StatusNotFound}, false},
+		{errors.New("pull model manifest: file does not exist"), false},
+		{errors.New("pull model manifest: 401: unauthorized"), false},
+		{errors.New("max retries exceeded: unexpected EOF"), true},
+		{errors.New("pull model manifest: 503"), true},
+		{errors.New("something else"), false},
+	} {
+		if transient := transientPullError(c.err); transient != c.transient {
+			t.Errorf("transientPullError(%v) expected %v, got %v", c.err, c.transient, transient)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	var delays []time.Duration
+	for attempt := 1; attempt <= 7; attempt++ {
+		delays = append(delays, retryBackoff(attempt))
+	}
+	expected := []time.Duration{2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second,
+		32 * time.Second, time.Minute, time.Minute}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("expected %v, got %v", expected, delays)
+	}
+}
+
+func TestAddRunningTask(t *testing.T) {
+	d := &DownLoader{tasks: map[string]*DownloadItem{
+		"m": {Model: "m", TaskType: downloadTaskPull, Status: downloadStatusRunning, running: true},
+	}}
+	if err := d.add("m", downloadTaskPull, false); err != nil {
+		t.Errorf("expected running pull ignored, got %v", err)
+	}
+	if err := d.add("m", downloadTaskPush, false); err == nil {
+		t.Error("expected error when pushing a model being pulled")
+	}
+}
+
+func TestCleanSucceededTask(t *testing.T) {
+	item := &DownloadItem{Model: "m", Status: downloadStatusSuccess}
+	d := &DownLoader{tasks: map[string]*DownloadItem{"m": item}}
+	// 完成后等待移除期间重新加入队列
+	d.lock.Lock()
+	item.Status = downloadStatusWaiting
+	item.removed = false
+	d.lock.Unlock()
+	d.clean(item)
+	if d.tasks["m"] != item {
+		t.Error("expected re-enqueued task kept")
+	}
+
+	item.Status = downloadStatusSuccess
+	d.clean(item)
+	if _, ok := d.tasks["m"]; ok {
+		t.Error("expected succeeded task removed")
+	}
+}
+
+func TestRemovedTaskNotSaved(t *testing.T) {
+	d := &DownLoader{}
+	// 已删除的任务不再访问数据库，未标记删除的任务不会被删除
+	d.persist(&DownloadItem{Model: "m", removed: true})
+	d.deleteTask(&DownloadItem{Model: "m"})
+
+	item := &DownloadItem{Model: "m", Status: downloadStatusRunning, Completed: 1, Total: 2, Priority: 3, Sequence: 4}
+	task := item.snapshot()
+	item.Completed = 2
+	if task.completed != 1 || task.total != 2 || task.priority != 3 || task.sequence != 4 {
+		t.Errorf("unexpected snapshot %+v", task)
+	}
+}
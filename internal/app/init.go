@@ -73,6 +73,10 @@ func StartApp(server *assetserver.Options) error {
 			&ollama,
 			&chat,
 			&configStore,
+			&prompt,
+			&arena,
+			&knowledge,
+			&completion,
 		},
 		Logger:             &logger{},
 		LogLevelProduction: ll,
@@ -0,0 +1,609 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"math"
+	"ollama-desktop/internal/document"
+	"ollama-desktop/internal/log"
+	olm "ollama-desktop/internal/ollama"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var knowledge = Knowledge{}
+
+const (
+	eventChatCitations = "chat_citations"
+
+	defaultChunkSize    = 800
+	defaultChunkOverlap = 100
+	defaultTopK         = 4
+	maxTopK             = 20
+	// 单次请求向量化的分块数量
+	embedBatchSize = 16
+)
+
+// 注入到问题前的知识库参考资料
+const knowledgePrompt = `请参考以下资料回答问题，引用资料时使用 [编号] 标注来源，资料与问题无关时忽略资料。
+
+%s
+问题：%s`
+
+// Knowledge 知识库，文档分块后使用向量模型向量化，问答时按余弦相似度检索相关分块
+type Knowledge struct {
+}
+
+// KnowledgeCitation 检索到的知识库分块，作为回答的引用来源
+type KnowledgeCitation struct {
+	// 引用编号，从 1 开始
+	Index           int     `json:"index"`
+	KnowledgeBaseId string  `json:"knowledgeBaseId"`
+	DocumentId      string  `json:"documentId"`
+	FileName        string  `json:"fileName"`
+	ChunkIndex      int     `json:"chunkIndex"`
+	Score           float64 `json:"score"`
+	Content         string  `json:"content"`
+}
+
+type ChatCitations struct {
+	SessionId string               `json:"sessionId"`
+	MessageId string               `json:"messageId"`
+	Citations []*KnowledgeCitation `json:"citations"`
+}
+
+const knowledgeBaseColumns = `id, name, description, embedding_model, chunk_size, chunk_overlap, top_k, created_at, updated_at`
+
+func (k *Knowledge) scanKnowledgeBase(rows *sql.Rows) (*KnowledgeBaseModel, error) {
+	base := &KnowledgeBaseModel{}
+	if err := rows.Scan(&base.Id, &base.Name, &base.Description, &base.EmbeddingModel, &base.ChunkSize, &base.ChunkOverlap,
+		&base.TopK, &base.CreatedAt, &base.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return base, nil
+}
+
+func (k *Knowledge) KnowledgeBases() ([]*KnowledgeBaseModel, error) {
+	sqlStr := `select ` + knowledgeBaseColumns + `
+            from t_knowledge_base
+            order by created_at desc`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr)
+	if err != nil {
+		log.Error().Err(err).Msg("query knowledge base error")
+		return nil, err
+	}
+	defer rows.Close()
+	var bases []*KnowledgeBaseModel
+	for rows.Next() {
+		base, err := k.scanKnowledgeBase(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill knowledge base error")
+			return nil, err
+		}
+		bases = append(bases, base)
+	}
+	return bases, nil
+}
+
+func (k *Knowledge) GetKnowledgeBase(id string) (*KnowledgeBaseModel, error) {
+	sqlStr := `select ` + knowledgeBaseColumns + `
+            from t_knowledge_base
+            where id = ?`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, id)
+	if err != nil {
+		log.Error().Err(err).Msg("query knowledge base error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		base, err := k.scanKnowledgeBase(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill knowledge base error")
+		}
+		return base, err
+	}
+	return nil, errors.New("knowledge base not exists")
+}
+
+func (k *Knowledge) CreateKnowledgeBase(base *KnowledgeBaseModel) (*KnowledgeBaseModel, error) {
+	if err := normalizeKnowledgeBase(base); err != nil {
+		return nil, err
+	}
+	base.Id = uuid.NewString()
+	base.CreatedAt = time.Now()
+	base.UpdatedAt = base.CreatedAt
+
+	sqlStr := `insert into t_knowledge_base(` + knowledgeBaseColumns + `)
+               values (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, base.Id, base.Name, base.Description, base.EmbeddingModel,
+		base.ChunkSize, base.ChunkOverlap, base.TopK, base.CreatedAt, base.UpdatedAt); err != nil {
+		log.Error().Err(err).Msg("create knowledge base error")
+		return nil, err
+	}
+	return base, nil
+}
+
+// UpdateKnowledgeBase 修改知识库，已有文档时不能修改向量模型，分块参数只对之后添加的文档生效
+func (k *Knowledge) UpdateKnowledgeBase(base *KnowledgeBaseModel) (*KnowledgeBaseModel, error) {
+	if err := normalizeKnowledgeBase(base); err != nil {
+		return nil, err
+	}
+	original, err := k.GetKnowledgeBase(base.Id)
+	if err != nil {
+		return nil, err
+	}
+	if original.EmbeddingModel != base.EmbeddingModel {
+		documents, err := k.Documents(base.Id)
+		if err != nil {
+			return nil, err
+		}
+		if len(documents) > 0 {
+			return nil, errors.New("embedding model cannot be changed when the knowledge base has documents")
+		}
+	}
+	base.CreatedAt = original.CreatedAt
+	base.UpdatedAt = time.Now()
+
+	sqlStr := `update t_knowledge_base set name = ?, description = ?, embedding_model = ?, chunk_size = ?, chunk_overlap = ?,
+                   top_k = ?, updated_at = ?
+               where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, base.Name, base.Description, base.EmbeddingModel, base.ChunkSize,
+		base.ChunkOverlap, base.TopK, base.UpdatedAt, base.Id); err != nil {
+		log.Error().Err(err).Msg("update knowledge base error")
+		return nil, err
+	}
+	return base, nil
+}
+
+func (k *Knowledge) DeleteKnowledgeBase(id string) (string, error) {
+	return id, dao.transaction(func(tx *sql.Tx) error {
+		sqlStr := "delete from t_knowledge_base where id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete knowledge base error")
+			return err
+		}
+		sqlStr = "delete from t_knowledge_document where knowledge_base_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete knowledge document error")
+			return err
+		}
+		sqlStr = "delete from t_knowledge_chunk where knowledge_base_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete knowledge chunk error")
+			return err
+		}
+		return nil
+	})
+}
+
+func normalizeKnowledgeBase(base *KnowledgeBaseModel) error {
+	base.Name = strings.TrimSpace(base.Name)
+	if base.Name == "" {
+		return errors.New("knowledge base name is required")
+	}
+	base.Name = truncateRunes(base.Name, 100)
+	if strings.TrimSpace(base.EmbeddingModel) == "" {
+		return errors.New("embedding model is required")
+	}
+	if base.ChunkSize <= 0 {
+		base.ChunkSize = defaultChunkSize
+	}
+	if base.ChunkOverlap < 0 {
+		base.ChunkOverlap = 0
+	}
+	if base.ChunkOverlap >= base.ChunkSize/2 {
+		return errors.New("chunk overlap must be less than half of chunk size")
+	}
+	if base.TopK <= 0 {
+		base.TopK = defaultTopK
+	}
+	if base.TopK > maxTopK {
+		base.TopK = maxTopK
+	}
+	return nil
+}
+
+// Documents 查询知识库中的文档
+func (k *Knowledge) Documents(knowledgeBaseId string) ([]*KnowledgeDocumentModel, error) {
+	sqlStr := `select id, knowledge_base_id, file_name, content_length, chunk_count, created_at
+            from t_knowledge_document
+            where knowledge_base_id = ?
+            order by created_at desc`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, knowledgeBaseId)
+	if err != nil {
+		log.Error().Err(err).Msg("query knowledge document error")
+		return nil, err
+	}
+	defer rows.Close()
+	var documents []*KnowledgeDocumentModel
+	for rows.Next() {
+		document := &KnowledgeDocumentModel{}
+		if err := rows.Scan(&document.Id, &document.KnowledgeBaseId, &document.FileName, &document.ContentLength,
+			&document.ChunkCount, &document.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("fill knowledge document error")
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
+
+type AddDocumentRequest struct {
+	KnowledgeBaseId string `json:"knowledgeBaseId"`
+	FileName        string `json:"fileName"`
+	Content         string `json:"content"`
+}
+
+// AddDocument 将文本内容分块并向量化后加入知识库
+func (k *Knowledge) AddDocument(request *AddDocumentRequest) (*KnowledgeDocumentModel, error) {
+	base, err := k.GetKnowledgeBase(request.KnowledgeBaseId)
+	if err != nil {
+		return nil, err
+	}
+	return k.addDocument(base, request.FileName, request.Content)
+}
+
+// ImportDocuments 选择文档导入知识库，返回导入成功的文档
+func (k *Knowledge) ImportDocuments(knowledgeBaseId string) ([]*KnowledgeDocumentModel, error) {
+	base, err := k.GetKnowledgeBase(knowledgeBaseId)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []string
+	for _, ext := range document.Extensions() {
+		patterns = append(patterns, "*"+ext)
+	}
+	paths, err := runtime.OpenMultipleFilesDialog(app.ctx, runtime.OpenDialogOptions{
+		Filters: []runtime.FileFilter{
+			{DisplayName: "Documents", Pattern: strings.Join(patterns, ";")},
+		},
+	})
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	var documents []*KnowledgeDocumentModel
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("read knowledge document error")
+			return documents, err
+		}
+		extracted, err := document.Extract(path, content)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("extract knowledge document error")
+			return documents, err
+		}
+		doc, err := k.addDocument(base, filepath.Base(path), extracted.Text)
+		if err != nil {
+			return documents, err
+		}
+		documents = append(documents, doc)
+	}
+	return documents, nil
+}
+
+func (k *Knowledge) addDocument(base *KnowledgeBaseModel, fileName, content string) (*KnowledgeDocumentModel, error) {
+	fileName = strings.TrimSpace(fileName)
+	if fileName == "" {
+		return nil, errors.New("file name is required")
+	}
+	chunks := chunkText(content, base.ChunkSize, base.ChunkOverlap)
+	if len(chunks) == 0 {
+		return nil, errors.New("document content is empty")
+	}
+	embeddings, err := k.embed(app.ctx, base.EmbeddingModel, chunks)
+	if err != nil {
+		return nil, err
+	}
+	document := &KnowledgeDocumentModel{
+		Id:              uuid.NewString(),
+		KnowledgeBaseId: base.Id,
+		FileName:        truncateRunes(fileName, 255),
+		ContentLength:   len([]rune(content)),
+		ChunkCount:      len(chunks),
+		CreatedAt:       time.Now(),
+	}
+	return document, dao.transaction(func(tx *sql.Tx) error {
+		sqlStr := `insert into t_knowledge_document(id, knowledge_base_id, file_name, content_length, chunk_count, created_at)
+                   values (?, ?, ?, ?, ?, ?)`
+		if _, err := tx.ExecContext(app.ctx, sqlStr, document.Id, document.KnowledgeBaseId, document.FileName,
+			document.ContentLength, document.ChunkCount, document.CreatedAt); err != nil {
+			log.Error().Err(err).Msg("create knowledge document error")
+			return err
+		}
+		sqlStr = `insert into t_knowledge_chunk(id, knowledge_base_id, document_id, chunk_index, content, embedding)
+                  values (?, ?, ?, ?, ?, ?)`
+		for i, chunk := range chunks {
+			if _, err := tx.ExecContext(app.ctx, sqlStr, uuid.NewString(), base.Id, document.Id, i, chunk,
+				encodeEmbedding(embeddings[i])); err != nil {
+				log.Error().Err(err).Msg("create knowledge chunk error")
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (k *Knowledge) DeleteDocument(id string) (string, error) {
+	return id, dao.transaction(func(tx *sql.Tx) error {
+		sqlStr := "delete from t_knowledge_document where id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete knowledge document error")
+			return err
+		}
+		sqlStr = "delete from t_knowledge_chunk where document_id = ?"
+		if _, err := tx.ExecContext(app.ctx, sqlStr, id); err != nil {
+			log.Error().Err(err).Msg("delete knowledge chunk error")
+			return err
+		}
+		return nil
+	})
+}
+
+// 分批调用向量模型
+func (k *Knowledge) embed(ctx context.Context, modelName string, inputs []string) ([][]float32, error) {
+	var embeddings [][]float32
+	for start := 0; start < len(inputs); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(inputs) {
+			end = len(inputs)
+		}
+		resp, err := ollama.newApiClient().Embed(ctx, &olm.EmbedRequest{
+			Model: modelName,
+			Input: inputs[start:end],
+		})
+		if err != nil {
+			log.Error().Err(err).Str("model", modelName).Msg("embed error")
+			return nil, err
+		}
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("embedding model %s returned %d embeddings for %d inputs", modelName, len(resp.Embeddings), end-start)
+		}
+		embeddings = append(embeddings, resp.Embeddings...)
+	}
+	return embeddings, nil
+}
+
+type SearchKnowledgeRequest struct {
+	KnowledgeBaseIds []string `json:"knowledgeBaseIds"`
+	Query            string   `json:"query"`
+}
+
+// SearchKnowledge 在知识库中检索与问题相关的分块，用于测试检索效果
+func (k *Knowledge) SearchKnowledge(request *SearchKnowledgeRequest) ([]*KnowledgeCitation, error) {
+	return k.retrieve(app.ctx, request.KnowledgeBaseIds, request.Query)
+}
+
+// 按余弦相似度检索多个知识库，返回数量为各知识库 top_k 的最大值
+// 使用不同向量模型的知识库分别向量化问题，相似度只在同一向量模型内计算
+func (k *Knowledge) retrieve(ctx context.Context, knowledgeBaseIds []string, query string) ([]*KnowledgeCitation, error) {
+	if len(knowledgeBaseIds) == 0 || strings.TrimSpace(query) == "" {
+		return nil, nil
+	}
+	topK := 0
+	models := make(map[string][]string)
+	for _, id := range knowledgeBaseIds {
+		base, err := k.GetKnowledgeBase(id)
+		if err != nil {
+			// 知识库已被删除
+			log.Warn().Err(err).Str("knowledgeBaseId", id).Msg("skip knowledge base")
+			continue
+		}
+		if base.TopK > topK {
+			topK = base.TopK
+		}
+		models[base.EmbeddingModel] = append(models[base.EmbeddingModel], base.Id)
+	}
+	var citations []*KnowledgeCitation
+	for modelName, ids := range models {
+		embeddings, err := k.embed(ctx, modelName, []string{query})
+		if err != nil {
+			return nil, err
+		}
+		scored, err := k.similarChunks(ids, embeddings[0], topK)
+		if err != nil {
+			return nil, err
+		}
+		citations = append(citations, scored...)
+	}
+	sort.SliceStable(citations, func(i, j int) bool {
+		return citations[i].Score > citations[j].Score
+	})
+	if len(citations) > topK {
+		citations = citations[:topK]
+	}
+	for i, citation := range citations {
+		citation.Index = i + 1
+	}
+	return citations, nil
+}
+
+// 计算知识库中所有分块与问题的相似度，返回最相似的 topK 个分块
+func (k *Knowledge) similarChunks(knowledgeBaseIds []string, query []float32, topK int) ([]*KnowledgeCitation, error) {
+	args := make([]interface{}, len(knowledgeBaseIds))
+	for i, id := range knowledgeBaseIds {
+		args[i] = id
+	}
+	sqlStr := `select c.knowledge_base_id, c.document_id, d.file_name, c.chunk_index, c.content, c.embedding
+            from t_knowledge_chunk c join t_knowledge_document d on d.id = c.document_id
+            where c.knowledge_base_id in (?` + strings.Repeat(", ?", len(knowledgeBaseIds)-1) + `)`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("query knowledge chunk error")
+		return nil, err
+	}
+	defer rows.Close()
+	var citations []*KnowledgeCitation
+	for rows.Next() {
+		citation := &KnowledgeCitation{}
+		var embedding []byte
+		if err := rows.Scan(&citation.KnowledgeBaseId, &citation.DocumentId, &citation.FileName, &citation.ChunkIndex,
+			&citation.Content, &embedding); err != nil {
+			log.Error().Err(err).Msg("fill knowledge chunk error")
+			return nil, err
+		}
+		score, ok := cosineSimilarity(query, decodeEmbedding(embedding))
+		if !ok {
+			continue
+		}
+		citation.Score = score
+		citations = append(citations, citation)
+	}
+	sort.SliceStable(citations, func(i, j int) bool {
+		return citations[i].Score > citations[j].Score
+	})
+	if len(citations) > topK {
+		citations = citations[:topK]
+	}
+	return citations, nil
+}
+
+// 解析会话关联的知识库编号
+func sessionKnowledgeBases(session *SessionModel) ([]string, error) {
+	if session.KnowledgeBases == "" {
+		return nil, nil
+	}
+	var ids []string
+	if err := json.Unmarshal([]byte(session.KnowledgeBases), &ids); err != nil {
+		return nil, fmt.Errorf("invalid session knowledge bases: %w", err)
+	}
+	return ids, nil
+}
+
+// 将检索到的参考资料与问题组合为发送给模型的问题
+func knowledgeQuestion(question string, citations []*KnowledgeCitation) string {
+	if len(citations) == 0 {
+		return question
+	}
+	var builder strings.Builder
+	for _, citation := range citations {
+		builder.WriteString(fmt.Sprintf("[%d] 来源：%s\n%s\n\n", citation.Index, citation.FileName, citation.Content))
+	}
+	return fmt.Sprintf(knowledgePrompt, builder.String(), question)
+}
+
+// 检索会话关联的知识库并保存引用来源，返回发送给模型的问题，question 为加入参考资料前的问题
+func (c *Chat) knowledgeQuestion(ctx context.Context, session *SessionModel, message *ChatMessageModel, question string) (string, error) {
+	ids, err := sessionKnowledgeBases(session)
+	if err != nil || len(ids) == 0 {
+		return question, err
+	}
+	citations, err := knowledge.retrieve(ctx, ids, message.QuestionContent)
+	if err != nil || len(citations) == 0 {
+		return question, err
+	}
+	data, err := json.Marshal(citations)
+	if err != nil {
+		return "", err
+	}
+	message.Citations = string(data)
+	runtime.EventsEmit(app.ctx, eventChatCitations, &ChatCitations{
+		SessionId: message.SessionId,
+		MessageId: message.Id,
+		Citations: citations,
+	})
+	return knowledgeQuestion(question, citations), nil
+}
+
+// 解析消息保存的引用来源
+func messageCitations(message *ChatMessageModel) []*KnowledgeCitation {
+	if message.Citations == "" {
+		return nil
+	}
+	var citations []*KnowledgeCitation
+	if err := json.Unmarshal([]byte(message.Citations), &citations); err != nil {
+		log.Error().Err(err).Str("messageId", message.Id).Msg("parse chat message citations error")
+		return nil
+	}
+	return citations
+}
+
+// 将文本按长度分块，相邻分块保留重叠部分
+// 分割点优先选择分块后半部分中的段落、换行、句末标点及空白，找不到时按长度截断
+func chunkText(text string, size, overlap int) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	runes := []rune(strings.TrimSpace(text))
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			end = len(runes)
+		} else if cut := chunkBoundary(runes[start:end]); cut > 0 {
+			end = start + cut
+		}
+		if chunk := strings.TrimSpace(string(runes[start:end])); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end == len(runes) {
+			break
+		}
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// 在分块后半部分查找分割点，返回分割点之后的位置，找不到时返回 0
+func chunkBoundary(runes []rune) int {
+	matchers := []func(i int) bool{
+		func(i int) bool { return runes[i] == '\n' && i > 0 && runes[i-1] == '\n' },
+		func(i int) bool { return runes[i] == '\n' },
+		func(i int) bool { return strings.ContainsRune("。！？；.!?;", runes[i]) },
+		func(i int) bool { return unicode.IsSpace(runes[i]) },
+	}
+	for _, matcher := range matchers {
+		for i := len(runes) - 1; i >= len(runes)/2; i-- {
+			if matcher(i) {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// 向量以 float32 小端序保存
+func encodeEmbedding(embedding []float32) []byte {
+	data := make([]byte, len(embedding)*4)
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(value))
+	}
+	return data
+}
+
+func decodeEmbedding(data []byte) []float32 {
+	embedding := make([]float32, len(data)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return embedding
+}
+
+// 计算余弦相似度，向量维度不一致或为零向量时返回 false
+func cosineSimilarity(a, b []float32) (float64, bool) {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0, false
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0, false
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB)), true
+}
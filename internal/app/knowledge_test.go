@@ -0,0 +1,66 @@
+package app
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChunkText(t *testing.T) {
+	text := "First paragraph line one.\nLine two.\n\nSecond paragraph is here. It has two sentences.\n\nThird."
+	chunks := chunkText(text, 40, 5)
+	if len(chunks) < 3 {
+		t.Fatalf("unexpected chunks %q", chunks)
+	}
+	for _, chunk := range chunks {
+		if n := len([]rune(chunk)); n > 40 {
+			t.Errorf("chunk %q exceeds size: %d", chunk, n)
+		}
+	}
+	if chunks[0] != "First paragraph line one.\nLine two." {
+		t.Errorf("expected first chunk to end at paragraph, got %q", chunks[0])
+	}
+	if last := chunks[len(chunks)-1]; !strings.HasSuffix(last, "Third.") {
+		t.Errorf("expected last chunk to contain the end of text, got %q", last)
+	}
+
+	// 没有分割点时按长度截断并保留重叠部分
+	chunks = chunkText(strings.Repeat("知", 25), 10, 2)
+	if !reflect.DeepEqual(chunks, []string{strings.Repeat("知", 10), strings.Repeat("知", 10), strings.Repeat("知", 9)}) {
+		t.Errorf("unexpected chunks %q", chunks)
+	}
+	if chunks := chunkText(" \n ", 10, 2); len(chunks) != 0 {
+		t.Errorf("expected no chunks, got %q", chunks)
+	}
+}
+
+func TestEmbedding(t *testing.T) {
+	embedding := []float32{0.5, -1.25, 3}
+	if decoded := decodeEmbedding(encodeEmbedding(embedding)); !reflect.DeepEqual(decoded, embedding) {
+		t.Errorf("expected %v, got %v", embedding, decoded)
+	}
+	if score, ok := cosineSimilarity([]float32{1, 0}, []float32{1, 1}); !ok || math.Abs(score-math.Sqrt2/2) > 1e-9 {
+		t.Errorf("unexpected score %v", score)
+	}
+	if _, ok := cosineSimilarity([]float32{1, 0}, []float32{1, 0, 0}); ok {
+		t.Error("expected dimension mismatch")
+	}
+	if _, ok := cosineSimilarity([]float32{0, 0}, []float32{1, 0}); ok {
+		t.Error("expected zero vector to be skipped")
+	}
+}
+
+func TestKnowledgeQuestion(t *testing.T) {
+	if question := knowledgeQuestion("What?", nil); question != "What?" {
+		t.Errorf("unexpected question %q", question)
+	}
+	question := knowledgeQuestion("What?", []*KnowledgeCitation{
+		{Index: 1, FileName: "a.md", Content: "alpha"},
+		{Index: 2, FileName: "b.txt", Content: "beta"},
+	})
+	if !strings.Contains(question, "[1] 来源：a.md\nalpha") || !strings.Contains(question, "[2] 来源：b.txt\nbeta") ||
+		!strings.HasSuffix(question, "问题：What?") {
+		t.Errorf("unexpected question %q", question)
+	}
+}
@@ -87,6 +87,10 @@ func (o *Ollama) Heartbeat() {
 	if started && o.version == "" {
 		o.version, _ = client.Version(app.ctx)
 	}
+	if started {
+		// 服务可用后继续上次未完成的下载
+		downloader.schedule()
+	}
 	goos := gorun.GOOS
 	runtime.EventsEmit(app.ctx, "ollamaHeartbeat", installed, started, !started && installed && (goos == "windows" || goos == "darwin"), o.version)
 }
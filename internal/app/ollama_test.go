@@ -54,7 +54,7 @@ func TestOllama_Chat(t *testing.T) {
 			},
 		},
 		Stream:    &stream,
-		Format:    "",
+		Format:    nil,
 		KeepAlive: nil,
 		Tools: []olm.Tool{
 			{
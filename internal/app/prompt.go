@@ -0,0 +1,268 @@
+package app
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"ollama-desktop/internal/log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var prompt = Prompt{}
+
+const (
+	templateTypeSystem = "system"
+	templateTypeUser   = "user"
+
+	maxTemplateTitleLength = 100
+)
+
+// 模板变量，格式为 {{变量名}}
+var templateVariableRegexp = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// 内置变量，渲染时自动填充
+var builtinVariables = map[string]func(modelName string) string{
+	"date": func(string) string {
+		return time.Now().Format(time.DateOnly)
+	},
+	"time": func(string) string {
+		return time.Now().Format(time.TimeOnly)
+	},
+	"datetime": func(string) string {
+		return time.Now().Format(time.DateTime)
+	},
+	"weekday": func(string) string {
+		return time.Now().Weekday().String()
+	},
+	"model": func(modelName string) string {
+		return modelName
+	},
+}
+
+type Prompt struct {
+}
+
+const promptTemplateColumns = `id, template_type, title, description, content, created_at, updated_at`
+
+func (p *Prompt) scanTemplate(rows *sql.Rows) (*PromptTemplateModel, error) {
+	template := &PromptTemplateModel{}
+	if err := rows.Scan(&template.Id, &template.TemplateType, &template.Title, &template.Description, &template.Content,
+		&template.CreatedAt, &template.UpdatedAt); err != nil {
+		return nil, err
+	}
+	template.Variables = templateVariables(template.Content)
+	return template, nil
+}
+
+// Templates 查询提示词模板，templateType 为空时查询全部
+func (p *Prompt) Templates(templateType string) ([]*PromptTemplateModel, error) {
+	sqlStr := `select ` + promptTemplateColumns + `
+            from t_prompt_template`
+	var args []interface{}
+	if templateType != "" {
+		sqlStr += ` where template_type = ?`
+		args = append(args, templateType)
+	}
+	sqlStr += ` order by title`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, args...)
+	if err != nil {
+		log.Error().Err(err).Msg("query prompt template error")
+		return nil, err
+	}
+	defer rows.Close()
+	var templates []*PromptTemplateModel
+	for rows.Next() {
+		template, err := p.scanTemplate(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill prompt template error")
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+func (p *Prompt) GetTemplate(id string) (*PromptTemplateModel, error) {
+	sqlStr := `select ` + promptTemplateColumns + `
+            from t_prompt_template
+            where id = ?`
+	rows, err := dao.db().QueryContext(app.ctx, sqlStr, id)
+	if err != nil {
+		log.Error().Err(err).Msg("query prompt template error")
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		template, err := p.scanTemplate(rows)
+		if err != nil {
+			log.Error().Err(err).Msg("fill prompt template error")
+		}
+		return template, err
+	}
+	return nil, errors.New("prompt template not exists")
+}
+
+func (p *Prompt) CreateTemplate(template *PromptTemplateModel) (*PromptTemplateModel, error) {
+	if err := normalizeTemplate(template); err != nil {
+		return nil, err
+	}
+	template.Id = uuid.NewString()
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = template.CreatedAt
+	template.Variables = templateVariables(template.Content)
+
+	return template, dao.transaction(func(tx *sql.Tx) error {
+		return p.insertTemplate(tx, template)
+	})
+}
+
+func (p *Prompt) insertTemplate(tx *sql.Tx, template *PromptTemplateModel) error {
+	sqlStr := `insert into t_prompt_template(` + promptTemplateColumns + `)
+               values (?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.ExecContext(app.ctx, sqlStr, template.Id, template.TemplateType, template.Title, template.Description,
+		template.Content, template.CreatedAt, template.UpdatedAt)
+	if err != nil {
+		log.Error().Err(err).Msg("create prompt template error")
+	}
+	return err
+}
+
+func (p *Prompt) UpdateTemplate(template *PromptTemplateModel) (*PromptTemplateModel, error) {
+	if err := normalizeTemplate(template); err != nil {
+		return nil, err
+	}
+	template.UpdatedAt = time.Now()
+	template.Variables = templateVariables(template.Content)
+
+	sqlStr := `update t_prompt_template set template_type = ?, title = ?, description = ?, content = ?, updated_at = ?
+               where id = ?`
+	_, err := dao.db().ExecContext(app.ctx, sqlStr, template.TemplateType, template.Title, template.Description,
+		template.Content, template.UpdatedAt, template.Id)
+	if err != nil {
+		log.Error().Err(err).Msg("update prompt template error")
+		return nil, err
+	}
+	return template, nil
+}
+
+func (p *Prompt) DeleteTemplate(id string) (string, error) {
+	sqlStr := `delete from t_prompt_template where id = ?`
+	if _, err := dao.db().ExecContext(app.ctx, sqlStr, id); err != nil {
+		log.Error().Err(err).Msg("delete prompt template error")
+		return "", err
+	}
+	return id, nil
+}
+
+// BuiltinVariables 渲染模板时自动填充的内置变量
+func (p *Prompt) BuiltinVariables() []string {
+	names := make([]string, 0, len(builtinVariables))
+	for name := range builtinVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type RenderTemplateRequest struct {
+	TemplateId string `json:"templateId"`
+	// 用于填充内置变量 model
+	ModelName string            `json:"modelName"`
+	Variables map[string]string `json:"variables"`
+}
+
+// RenderTemplate 使用变量渲染模板内容
+func (p *Prompt) RenderTemplate(request *RenderTemplateRequest) (string, error) {
+	template, err := p.GetTemplate(request.TemplateId)
+	if err != nil {
+		return "", err
+	}
+	return renderTemplate(template.Content, request.ModelName, request.Variables)
+}
+
+type CreateSessionFromTemplateRequest struct {
+	TemplateId string            `json:"templateId"`
+	Session    *SessionModel     `json:"session"`
+	Variables  map[string]string `json:"variables"`
+}
+
+// CreateSessionFromTemplate 使用系统消息模板创建会话，未填写会话名称时使用模板名称
+func (p *Prompt) CreateSessionFromTemplate(request *CreateSessionFromTemplateRequest) (*SessionModel, error) {
+	template, err := p.GetTemplate(request.TemplateId)
+	if err != nil {
+		return nil, err
+	}
+	if template.TemplateType != templateTypeSystem {
+		return nil, errors.New("only system templates can be used to create sessions")
+	}
+	session := request.Session
+	if session == nil {
+		return nil, errors.New("session is required")
+	}
+	if session.SystemMessage, err = renderTemplate(template.Content, session.ModelName, request.Variables); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(session.SessionName) == "" {
+		session.SessionName = truncateRunes(template.Title, maxSessionNameLength)
+	}
+	return chat.CreateSession(session)
+}
+
+// 校验并规范化模板
+func normalizeTemplate(template *PromptTemplateModel) error {
+	template.Title = strings.TrimSpace(template.Title)
+	if template.Title == "" {
+		return errors.New("template title is required")
+	}
+	template.Title = truncateRunes(template.Title, maxTemplateTitleLength)
+	if strings.TrimSpace(template.Content) == "" {
+		return errors.New("template content is required")
+	}
+	switch template.TemplateType {
+	case templateTypeSystem, templateTypeUser:
+	case "":
+		template.TemplateType = templateTypeSystem
+	default:
+		return fmt.Errorf("unsupported template type: %s", template.TemplateType)
+	}
+	return nil
+}
+
+// 模板中需要用户填写的变量，按出现顺序去重
+func templateVariables(content string) []string {
+	var variables []string
+	exists := make(map[string]bool)
+	for _, match := range templateVariableRegexp.FindAllStringSubmatch(content, -1) {
+		name := match[1]
+		if _, ok := builtinVariables[name]; ok || exists[name] {
+			continue
+		}
+		exists[name] = true
+		variables = append(variables, name)
+	}
+	return variables
+}
+
+// 渲染模板，用户变量优先于内置变量，存在未填写的变量时返回错误
+func renderTemplate(content, modelName string, variables map[string]string) (string, error) {
+	var missing []string
+	result := templateVariableRegexp.ReplaceAllStringFunc(content, func(match string) string {
+		name := templateVariableRegexp.FindStringSubmatch(match)[1]
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		if builtin, ok := builtinVariables[name]; ok {
+			return builtin(modelName)
+		}
+		missing = append(missing, name)
+		return match
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing value for variable %q", missing[0])
+	}
+	return result, nil
+}
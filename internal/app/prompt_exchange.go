@@ -0,0 +1,301 @@
+package app
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+	"ollama-desktop/internal/log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	templateExportFormatJson = "json"
+	templateExportFormatCsv  = "csv"
+
+	// 导出 json 文件格式标识及版本
+	templateExportFormat  = "ollama-desktop-prompts"
+	templateExportVersion = 1
+)
+
+// 导出 csv 文件的列
+var templateCsvHeader = []string{"title", "type", "description", "content"}
+
+// 导入 csv 文件时可识别的列名，兼容 awesome-chatgpt-prompts 的 act、prompt 列
+var templateCsvColumns = map[string]string{
+	"title":       "title",
+	"name":        "title",
+	"act":         "title",
+	"type":        "type",
+	"description": "description",
+	"content":     "content",
+	"prompt":      "content",
+}
+
+// PromptTemplateExport 提示词模板导出文件
+type PromptTemplateExport struct {
+	Format     string                 `json:"format"`
+	Version    int                    `json:"version"`
+	ExportedAt time.Time              `json:"exportedAt"`
+	Templates  []*PromptTemplateModel `json:"templates"`
+}
+
+type ExportTemplatesRequest struct {
+	// 导出的模板编号，为空时导出全部
+	TemplateIds []string `json:"templateIds"`
+	// 导出格式：json、csv
+	Format string `json:"format"`
+}
+
+// ExportTemplates 导出提示词模板，弹出保存文件对话框，返回保存的文件路径，取消保存时返回空字符串
+func (p *Prompt) ExportTemplates(request *ExportTemplatesRequest) (string, error) {
+	var templates []*PromptTemplateModel
+	if len(request.TemplateIds) == 0 {
+		var err error
+		if templates, err = p.Templates(""); err != nil {
+			return "", err
+		}
+	} else {
+		for _, id := range request.TemplateIds {
+			template, err := p.GetTemplate(id)
+			if err != nil {
+				return "", err
+			}
+			templates = append(templates, template)
+		}
+	}
+	if len(templates) == 0 {
+		return "", errors.New("no template to export")
+	}
+
+	var content []byte
+	var ext, displayName string
+	var err error
+	switch request.Format {
+	case templateExportFormatJson:
+		ext, displayName = ".json", "JSON (*.json)"
+		content, err = json.MarshalIndent(&PromptTemplateExport{
+			Format:     templateExportFormat,
+			Version:    templateExportVersion,
+			ExportedAt: time.Now(),
+			Templates:  templates,
+		}, "", "  ")
+	case templateExportFormatCsv:
+		ext, displayName = ".csv", "CSV (*.csv)"
+		content, err = exportTemplatesCsv(templates)
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", request.Format)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("export prompt template error")
+		return "", err
+	}
+
+	path, err := runtime.SaveFileDialog(app.ctx, runtime.SaveDialogOptions{
+		DefaultFilename: "ollama-desktop-prompts-" + time.Now().Format("20060102150405") + ext,
+		Filters: []runtime.FileFilter{
+			{DisplayName: displayName, Pattern: "*" + ext},
+		},
+	})
+	if err != nil || path == "" {
+		return "", err
+	}
+	if !strings.HasSuffix(strings.ToLower(path), ext) {
+		path += ext
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		log.Error().Err(err).Msg("write export file error")
+		return "", err
+	}
+	return path, nil
+}
+
+func exportTemplatesCsv(templates []*PromptTemplateModel) ([]byte, error) {
+	var buf bytes.Buffer
+	// 写入 BOM 以便表格软件正确识别编码
+	buf.WriteString("\ufeff")
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(templateCsvHeader); err != nil {
+		return nil, err
+	}
+	for _, template := range templates {
+		if err := writer.Write([]string{template.Title, template.TemplateType, template.Description, template.Content}); err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// ImportTemplates 从 json 或 csv 文件导入提示词模板，已存在的相同模板会被跳过
+func (p *Prompt) ImportTemplates() ([]*PromptTemplateModel, error) {
+	path, err := runtime.OpenFileDialog(app.ctx, runtime.OpenDialogOptions{
+		Filters: []runtime.FileFilter{
+			{DisplayName: "JSON, CSV (*.json;*.csv)", Pattern: "*.json;*.csv"},
+		},
+	})
+	if err != nil || path == "" {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		log.Error().Err(err).Msg("read import file error")
+		return nil, err
+	}
+	var templates []*PromptTemplateModel
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		templates, err = parseTemplatesCsv(content)
+	} else {
+		templates, err = parseTemplatesJson(content)
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("parse import file error")
+		return nil, err
+	}
+
+	existing, err := p.Templates("")
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool)
+	for _, template := range existing {
+		exists[templateKey(template)] = true
+	}
+	var imported []*PromptTemplateModel
+	err = dao.transaction(func(tx *sql.Tx) error {
+		for _, template := range templates {
+			if err := normalizeTemplate(template); err != nil {
+				log.Warn().Err(err).Str("title", template.Title).Msg("skip invalid prompt template")
+				continue
+			}
+			key := templateKey(template)
+			if exists[key] {
+				continue
+			}
+			exists[key] = true
+			template.Id = uuid.NewString()
+			template.CreatedAt = time.Now()
+			template.UpdatedAt = template.CreatedAt
+			template.Variables = templateVariables(template.Content)
+			if err := p.insertTemplate(tx, template); err != nil {
+				return err
+			}
+			imported = append(imported, template)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imported, nil
+}
+
+func templateKey(template *PromptTemplateModel) string {
+	return template.TemplateType + "\x00" + template.Title + "\x00" + template.Content
+}
+
+// 解析 json 格式的模板，支持导出文件及模板数组
+func parseTemplatesJson(content []byte) ([]*PromptTemplateModel, error) {
+	content = bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\ufeff")))
+	var items []map[string]interface{}
+	if bytes.HasPrefix(content, []byte("{")) {
+		var export struct {
+			Format    string                   `json:"format"`
+			Version   int                      `json:"version"`
+			Templates []map[string]interface{} `json:"templates"`
+		}
+		if err := json.Unmarshal(content, &export); err != nil {
+			return nil, err
+		}
+		if export.Format != templateExportFormat {
+			return nil, errors.New("unsupported template file")
+		}
+		if export.Version > templateExportVersion {
+			return nil, fmt.Errorf("unsupported template file version %d", export.Version)
+		}
+		items = export.Templates
+	} else if err := json.Unmarshal(content, &items); err != nil {
+		return nil, err
+	}
+	var templates []*PromptTemplateModel
+	for _, item := range items {
+		fields := make(map[string]string)
+		for name, value := range item {
+			if value, ok := value.(string); ok {
+				fields[name] = value
+			}
+		}
+		templates = append(templates, &PromptTemplateModel{
+			TemplateType: firstNonEmpty(fields["templateType"], templateTypeOf(fields["type"])),
+			Title:        firstNonEmpty(fields["title"], fields["name"], fields["act"]),
+			Description:  fields["description"],
+			Content:      firstNonEmpty(fields["content"], fields["prompt"]),
+		})
+	}
+	return templates, nil
+}
+
+// 解析 csv 格式的模板，首行为列名
+func parseTemplatesCsv(content []byte) ([]*PromptTemplateModel, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("empty template file")
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		if column, ok := templateCsvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			if _, exists := columns[column]; !exists {
+				columns[column] = i
+			}
+		}
+	}
+	if _, ok := columns["content"]; !ok {
+		return nil, errors.New("template file must contain a content or prompt column")
+	}
+	value := func(record []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	var templates []*PromptTemplateModel
+	for _, record := range records[1:] {
+		templates = append(templates, &PromptTemplateModel{
+			TemplateType: templateTypeOf(value(record, "type")),
+			Title:        value(record, "title"),
+			Description:  value(record, "description"),
+			Content:      value(record, "content"),
+		})
+	}
+	return templates, nil
+}
+
+// 识别模板类型，awesome-chatgpt-prompts 等来源的 type 列含义不同，无法识别时作为系统消息
+func templateTypeOf(value string) string {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case templateTypeUser:
+		return templateTypeUser
+	}
+	return templateTypeSystem
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	content := "You are {{ role }} for {{model}}. Today is {{date}}. Answer in {{language}}, {{role}}."
+	if variables := templateVariables(content); !reflect.DeepEqual(variables, []string{"role", "language"}) {
+		t.Errorf("unexpected variables %v", variables)
+	}
+	result, err := renderTemplate(content, "llama3", map[string]string{"role": "a translator", "language": "English"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "You are a translator for llama3. Today is " + time.Now().Format(time.DateOnly) +
+		". Answer in English, a translator."
+	if result != expected {
+		t.Errorf("expected %q, got %q", expected, result)
+	}
+	if _, err := renderTemplate(content, "llama3", map[string]string{"role": "a translator"}); err == nil ||
+		err.Error() != `missing value for variable "language"` {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestParseTemplatesCsv(t *testing.T) {
+	content := "\ufeff\"act\",\"prompt\",\"for_devs\",\"type\"\n" +
+		"\"Linux Terminal\",\"I want you to act as a linux terminal.\",\"TRUE\",\"TEXT\"\n" +
+		"\"Translator\",\"Translate {{text}}\",\"FALSE\",\"TEXT\"\n"
+	templates, err := parseTemplatesCsv([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 2 {
+		t.Fatalf("expected 2 templates, got %d", len(templates))
+	}
+	if template := templates[0]; template.Title != "Linux Terminal" || template.TemplateType != templateTypeSystem ||
+		template.Content != "I want you to act as a linux terminal." {
+		t.Errorf("unexpected template %+v", template)
+	}
+
+	exported, err := exportTemplatesCsv([]*PromptTemplateModel{{Title: "Ask", TemplateType: templateTypeUser, Content: "a,\"b\"\nc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates, err = parseTemplatesCsv(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].TemplateType != templateTypeUser || templates[0].Content != "a,\"b\"\nc" {
+		t.Errorf("unexpected templates %+v", templates[0])
+	}
+}
+
+func TestParseTemplatesJson(t *testing.T) {
+	templates, err := parseTemplatesJson([]byte(`[{"act": "Poet", "prompt": "Write a poem"}, {"title": "Ask", "type": "user", "content": "{{q}}"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 2 || templates[0].Title != "Poet" || templates[1].TemplateType != templateTypeUser {
+		t.Errorf("unexpected templates %+v %+v", templates[0], templates[1])
+	}
+	if _, err := parseTemplatesJson([]byte(`{"format": "other", "templates": []}`)); err == nil {
+		t.Error("expected unsupported file error")
+	}
+}
@@ -0,0 +1,513 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	olm "ollama-desktop/internal/ollama"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	messageRoleTool = "tool"
+
+	// 单次回答最多允许的工具调用轮次
+	maxToolRounds = 10
+	// 读取文件工具允许读取的最大字节数
+	maxToolFileSize = 64 * 1024
+)
+
+// Tool 本地工具，可以注册到工具注册表中供模型调用
+type Tool interface {
+	// 工具定义，会原样发送给模型
+	Definition() olm.ToolFunction
+	// 执行工具调用，返回的文本会作为工具消息回传给模型
+	Call(ctx context.Context, arguments olm.ToolCallFunctionArguments) (string, error)
+}
+
+type ToolInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+var toolRegistry = ToolRegistry{}
+
+type ToolRegistry struct {
+	tools map[string]Tool
+	lock  sync.RWMutex
+}
+
+func init() {
+	toolRegistry.Register(&calculatorTool{})
+	toolRegistry.Register(&currentTimeTool{})
+	toolRegistry.Register(&readFileTool{})
+}
+
+// Register 注册工具，同名工具会被覆盖
+func (r *ToolRegistry) Register(tool Tool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.tools == nil {
+		r.tools = make(map[string]Tool)
+	}
+	r.tools[tool.Definition().Name] = tool
+}
+
+func (r *ToolRegistry) get(name string) (Tool, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	tool, ok := r.tools[name]
+	return tool, ok
+}
+
+func (r *ToolRegistry) list() []*ToolInfo {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var infos []*ToolInfo
+	for _, tool := range r.tools {
+		definition := tool.Definition()
+		infos = append(infos, &ToolInfo{
+			Name:        definition.Name,
+			Description: definition.Description,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// 获取指定名称工具的定义，未注册的工具会被忽略
+func (r *ToolRegistry) definitions(names []string) olm.Tools {
+	var tools olm.Tools
+	for _, name := range names {
+		if tool, ok := r.get(name); ok {
+			tools = append(tools, olm.Tool{
+				Type:     "function",
+				Function: tool.Definition(),
+			})
+		}
+	}
+	return tools
+}
+
+// 解析会话中启用的工具
+func sessionTools(session *SessionModel) ([]string, error) {
+	if session.Tools == "" {
+		return nil, nil
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(session.Tools), &names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func stringArgument(arguments olm.ToolCallFunctionArguments, name string) string {
+	value, ok := arguments[name]
+	if !ok || value == nil {
+		return ""
+	}
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+type calculatorTool struct {
+}
+
+func (t *calculatorTool) Definition() olm.ToolFunction {
+	return olm.ToolFunction{
+		Name:        "calculator",
+		Description: "Evaluate a mathematical expression, supports + - * / % ^, parentheses and functions such as sqrt, pow, abs, sin, cos, tan, log, ln, exp, floor, ceil, round",
+		Parameters: olm.ToolFunctionParameters{
+			Type:     "object",
+			Required: []string{"expression"},
+			Properties: map[string]olm.ToolFunctionParametersProperty{
+				"expression": {
+					Type:        "string",
+					Description: "The expression to evaluate, e.g. (2 + 3) * sqrt(16)",
+				},
+			},
+		},
+	}
+}
+
+func (t *calculatorTool) Call(ctx context.Context, arguments olm.ToolCallFunctionArguments) (string, error) {
+	expression := stringArgument(arguments, "expression")
+	if expression == "" {
+		return "", errors.New("expression is required")
+	}
+	value, err := evalExpression(expression)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64), nil
+}
+
+// 计算数学表达式，^ 为乘方运算
+func evalExpression(expression string) (float64, error) {
+	p := &exprParser{input: []rune(expression)}
+	value, err := p.parseExpr()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected character %q at %d", p.input[p.pos], p.pos)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errors.New("result is not a finite number")
+	}
+	return value, nil
+}
+
+// 表达式解析器
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/" | "%") unary }
+//	unary   = ("+" | "-") unary | power
+//	power   = primary [ "^" unary ]
+//	primary = number | ident | ident "(" expr { "," expr } ")" | "(" expr ")"
+type exprParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *exprParser) accept(char rune) bool {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == char {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) parseExpr() (float64, error) {
+	x, err := p.parseTerm()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch {
+		case p.accept('+'):
+			y, err := p.parseTerm()
+			if err != nil {
+				return 0, err
+			}
+			x += y
+		case p.accept('-'):
+			y, err := p.parseTerm()
+			if err != nil {
+				return 0, err
+			}
+			x -= y
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *exprParser) parseTerm() (float64, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var op rune
+		switch {
+		case p.accept('*'):
+			op = '*'
+		case p.accept('/'):
+			op = '/'
+		case p.accept('%'):
+			op = '%'
+		default:
+			return x, nil
+		}
+		y, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			x *= y
+		case '/':
+			if y == 0 {
+				return 0, errors.New("division by zero")
+			}
+			x /= y
+		case '%':
+			if y == 0 {
+				return 0, errors.New("division by zero")
+			}
+			x = math.Mod(x, y)
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (float64, error) {
+	if p.accept('-') {
+		x, err := p.parseUnary()
+		return -x, err
+	}
+	if p.accept('+') {
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+func (p *exprParser) parsePower() (float64, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return 0, err
+	}
+	if p.accept('^') {
+		// 乘方为右结合
+		y, err := p.parseUnary()
+		if err != nil {
+			return 0, err
+		}
+		return math.Pow(x, y), nil
+	}
+	return x, nil
+}
+
+func (p *exprParser) parsePrimary() (float64, error) {
+	if p.accept('(') {
+		x, err := p.parseExpr()
+		if err != nil {
+			return 0, err
+		}
+		if !p.accept(')') {
+			return 0, errors.New("missing closing parenthesis")
+		}
+		return x, nil
+	}
+	p.skipSpace()
+	start := p.pos
+	if p.pos < len(p.input) && (unicode.IsDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+		for p.pos < len(p.input) && (unicode.IsDigit(p.input[p.pos]) || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		// 科学计数法
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			next := p.pos + 1
+			if next < len(p.input) && (p.input[next] == '+' || p.input[next] == '-') {
+				next++
+			}
+			if next < len(p.input) && unicode.IsDigit(p.input[next]) {
+				p.pos = next
+				for p.pos < len(p.input) && unicode.IsDigit(p.input[p.pos]) {
+					p.pos++
+				}
+			}
+		}
+		value, err := strconv.ParseFloat(string(p.input[start:p.pos]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number: %s", string(p.input[start:p.pos]))
+		}
+		return value, nil
+	}
+	for p.pos < len(p.input) && (unicode.IsLetter(p.input[p.pos]) || unicode.IsDigit(p.input[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos >= len(p.input) {
+			return 0, errors.New("unexpected end of expression")
+		}
+		return 0, fmt.Errorf("unexpected character %q at %d", p.input[p.pos], p.pos)
+	}
+	name := strings.ToLower(string(p.input[start:p.pos]))
+	if !p.accept('(') {
+		switch name {
+		case "pi":
+			return math.Pi, nil
+		case "e":
+			return math.E, nil
+		}
+		return 0, fmt.Errorf("unknown identifier: %s", name)
+	}
+	var args []float64
+	if !p.accept(')') {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return 0, err
+			}
+			args = append(args, arg)
+			if p.accept(')') {
+				break
+			}
+			if !p.accept(',') {
+				return 0, errors.New("missing closing parenthesis")
+			}
+		}
+	}
+	return evalFunction(name, args)
+}
+
+func evalFunction(name string, args []float64) (float64, error) {
+	unary := map[string]func(float64) float64{
+		"sqrt":  math.Sqrt,
+		"abs":   math.Abs,
+		"sin":   math.Sin,
+		"cos":   math.Cos,
+		"tan":   math.Tan,
+		"asin":  math.Asin,
+		"acos":  math.Acos,
+		"atan":  math.Atan,
+		"log":   math.Log10,
+		"ln":    math.Log,
+		"exp":   math.Exp,
+		"floor": math.Floor,
+		"ceil":  math.Ceil,
+		"round": math.Round,
+	}
+	if fn, ok := unary[name]; ok {
+		if len(args) != 1 {
+			return 0, fmt.Errorf("function %s expects 1 argument", name)
+		}
+		return fn(args[0]), nil
+	}
+	switch name {
+	case "pow":
+		if len(args) != 2 {
+			return 0, errors.New("function pow expects 2 arguments")
+		}
+		return math.Pow(args[0], args[1]), nil
+	case "min", "max":
+		if len(args) == 0 {
+			return 0, fmt.Errorf("function %s expects at least 1 argument", name)
+		}
+		result := args[0]
+		for _, arg := range args[1:] {
+			if name == "min" {
+				result = math.Min(result, arg)
+			} else {
+				result = math.Max(result, arg)
+			}
+		}
+		return result, nil
+	}
+	return 0, fmt.Errorf("unknown function: %s", name)
+}
+
+type currentTimeTool struct {
+}
+
+func (t *currentTimeTool) Definition() olm.ToolFunction {
+	return olm.ToolFunction{
+		Name:        "current_time",
+		Description: "Get the current date and time",
+		Parameters: olm.ToolFunctionParameters{
+			Type:     "object",
+			Required: []string{},
+			Properties: map[string]olm.ToolFunctionParametersProperty{
+				"timezone": {
+					Type:        "string",
+					Description: "IANA time zone name, e.g. Asia/Shanghai, defaults to the local time zone",
+				},
+			},
+		},
+	}
+}
+
+func (t *currentTimeTool) Call(ctx context.Context, arguments olm.ToolCallFunctionArguments) (string, error) {
+	now := time.Now()
+	if timezone := stringArgument(arguments, "timezone"); timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if err != nil {
+			return "", err
+		}
+		now = now.In(location)
+	}
+	return now.Format("2006-01-02 15:04:05 Monday MST"), nil
+}
+
+type readFileTool struct {
+}
+
+func (t *readFileTool) Definition() olm.ToolFunction {
+	return olm.ToolFunction{
+		Name:        "read_file",
+		Description: "Read the text content of a file from the allowed folder",
+		Parameters: olm.ToolFunctionParameters{
+			Type:     "object",
+			Required: []string{"path"},
+			Properties: map[string]olm.ToolFunctionParametersProperty{
+				"path": {
+					Type:        "string",
+					Description: "The file path relative to the allowed folder",
+				},
+			},
+		},
+	}
+}
+
+func (t *readFileTool) Call(ctx context.Context, arguments olm.ToolCallFunctionArguments) (string, error) {
+	dir, err := configStore.get(configToolFileDir)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return "", errors.New("no folder is allowed to read")
+	}
+	path := stringArgument(arguments, "path")
+	if path == "" {
+		return "", errors.New("path is required")
+	}
+	path, err = allowedFilePath(dir, path)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxToolFileSize))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// 解析允许目录中的文件路径，解析符号链接后的实际路径必须位于允许目录之内
+func allowedFilePath(dir, path string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return "", err
+	}
+	if path, err = filepath.EvalSymlinks(filepath.Clean(path)); err != nil {
+		return "", err
+	}
+	// 禁止读取允许目录之外的文件
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("file is outside of the allowed folder")
+	}
+	return path, nil
+}
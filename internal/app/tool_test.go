@@ -0,0 +1,67 @@
+package app
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvalExpression(t *testing.T) {
+	cases := []struct {
+		expression string
+		expected   float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"2 * 3 ^ 2", 18},
+		{"2 ^ 3 ^ 2", 512},
+		{"-2 ^ 2", -4},
+		{"10 % 4", 2},
+		{"sqrt(16) + pow(2, 3)", 12},
+		{"max(1, 5, 3) - min(4, 2)", 3},
+		{"1.5e2 / 3", 50},
+		{"round(pi * 100)", 314},
+	}
+	for _, c := range cases {
+		value, err := evalExpression(c.expression)
+		if err != nil {
+			t.Fatalf("%s: %v", c.expression, err)
+		}
+		if math.Abs(value-c.expected) > 1e-9 {
+			t.Errorf("%s = %v, expected %v", c.expression, value, c.expected)
+		}
+	}
+
+	for _, expression := range []string{"1 / 0", "1 +", "(1 + 2", "foo(1)", "1 $ 2"} {
+		if _, err := evalExpression(expression); err == nil {
+			t.Errorf("%s: expected error", expression)
+		}
+	}
+}
+
+func TestAllowedFilePath(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "allowed")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	inside := filepath.Join(dir, "inside.txt")
+	outside := filepath.Join(root, "outside.txt")
+	for _, file := range []string{inside, outside} {
+		if err := os.WriteFile(file, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link.txt")); err != nil {
+		t.Skip("symlink is not supported:", err)
+	}
+	if path, err := allowedFilePath(dir, "inside.txt"); err != nil || filepath.Base(path) != "inside.txt" {
+		t.Errorf("expected inside file allowed, got %s %v", path, err)
+	}
+	for _, path := range []string{"link.txt", "../outside.txt", outside} {
+		if _, err := allowedFilePath(dir, path); err == nil {
+			t.Errorf("expected %s to be rejected", path)
+		}
+	}
+}
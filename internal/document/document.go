@@ -0,0 +1,189 @@
+// Package document 提取常见文档格式中的文本内容
+//
+// 提取结果为规范化后的纯文本，并记录分页及标题在文本中的位置，
+// 不同格式通过 Register 注册的 Extractor 处理，按文件扩展名选择。
+package document
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+var ErrUnsupported = errors.New("unsupported document format")
+
+// Document 提取后的文档
+type Document struct {
+	// 文档格式，对应注册时的格式名称
+	Format string `json:"format"`
+	// 规范化后的文本
+	Text string `json:"text"`
+	// 分页信息，只有 PDF 等分页格式提供
+	Pages []*Page `json:"pages,omitempty"`
+	// 文档中的标题，按出现顺序排序
+	Headings []*Heading `json:"headings,omitempty"`
+}
+
+type Page struct {
+	// 页码，从 1 开始
+	Number int `json:"number"`
+	// 页面内容在文本中的起始位置，单位为字符
+	Offset int `json:"offset"`
+}
+
+type Heading struct {
+	// 标题级别，从 1 开始
+	Level int    `json:"level"`
+	Title string `json:"title"`
+	// 标题在文本中的起始位置，单位为字符
+	Offset int `json:"offset"`
+	// 标题所在页码，没有分页信息时为 0
+	Page int `json:"page,omitempty"`
+}
+
+// Extractor 文档提取器
+type Extractor interface {
+	Extract(data []byte) (*Document, error)
+}
+
+type ExtractorFunc func(data []byte) (*Document, error)
+
+func (f ExtractorFunc) Extract(data []byte) (*Document, error) {
+	return f(data)
+}
+
+var (
+	extractors = make(map[string]Extractor)
+	lock       sync.RWMutex
+)
+
+// Register 为文件扩展名注册提取器，扩展名包含点号，如 .txt
+func Register(ext string, extractor Extractor) {
+	lock.Lock()
+	defer lock.Unlock()
+	extractors[strings.ToLower(ext)] = extractor
+}
+
+// Extensions 已注册提取器的文件扩展名
+func Extensions() []string {
+	lock.RLock()
+	defer lock.RUnlock()
+	exts := make([]string, 0, len(extractors))
+	for ext := range extractors {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// Supported 是否支持提取指定文件
+func Supported(fileName string) bool {
+	lock.RLock()
+	defer lock.RUnlock()
+	_, ok := extractors[strings.ToLower(filepath.Ext(fileName))]
+	return ok
+}
+
+// Extract 按文件扩展名提取文档内容
+func Extract(fileName string, data []byte) (*Document, error) {
+	lock.RLock()
+	extractor, ok := extractors[strings.ToLower(filepath.Ext(fileName))]
+	lock.RUnlock()
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return extractor.Extract(data)
+}
+
+var blankLinesRegexp = regexp.MustCompile(`\n{3,}`)
+
+// Normalize 规范化文本：统一换行符，去除控制字符及行尾空白，合并连续空行
+func Normalize(text string) string {
+	text = strings.TrimPrefix(text, "\ufeff")
+	text = strings.ToValidUTF8(text, string(utf8.RuneError))
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r == ' ':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, text)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	text = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLinesRegexp.ReplaceAllString(text, "\n\n"))
+}
+
+// 逐段构建文档文本，记录标题及分页位置
+type builder struct {
+	text     strings.Builder
+	length   int
+	page     int
+	pages    []*Page
+	headings []*Heading
+	// 新页面是否还没有内容
+	pageStarted bool
+}
+
+// 写入一段文本，段落之间以空行分隔
+func (b *builder) paragraph(text string) {
+	text = Normalize(text)
+	if text == "" {
+		return
+	}
+	b.separate()
+	b.write(text)
+}
+
+func (b *builder) heading(level int, title string) {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return
+	}
+	b.separate()
+	b.headings = append(b.headings, &Heading{Level: level, Title: title, Offset: b.length, Page: b.page})
+	b.write(title)
+}
+
+// 开始新的一页，没有内容的页面不记录分页信息
+func (b *builder) newPage() {
+	b.page++
+	b.pageStarted = true
+}
+
+func (b *builder) separate() {
+	if b.length > 0 {
+		b.write("\n\n")
+	}
+	if b.pageStarted {
+		b.pages = append(b.pages, &Page{Number: b.page, Offset: b.length})
+		b.pageStarted = false
+	}
+}
+
+func (b *builder) write(text string) {
+	b.text.WriteString(text)
+	b.length += utf8.RuneCountInString(text)
+}
+
+func (b *builder) document(format string) *Document {
+	return &Document{
+		Format:   format,
+		Text:     b.text.String(),
+		Pages:    b.pages,
+		Headings: b.headings,
+	}
+}
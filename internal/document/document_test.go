@@ -0,0 +1,150 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	text := Normalize("\ufeff  first line  \r\nsecond\x00 line\t\r\n\r\n\r\n\r\nthird\rend \n\n")
+	if expected := "first line\nsecond line\n\nthird\nend"; text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+}
+
+func TestExtractUnsupported(t *testing.T) {
+	if _, err := Extract("image.png", []byte("data")); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	if !Supported("README.MD") || Supported("archive.zip") {
+		t.Error("unexpected supported result")
+	}
+}
+
+func TestExtractMarkdown(t *testing.T) {
+	doc, err := Extract("note.md", []byte("# 标题\n\n正文\n\n```\n# 代码\n```\n\nSetext\n---\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Format != FormatMarkdown || len(doc.Headings) != 2 {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+	for i, expected := range []*Heading{{Level: 1, Title: "标题", Offset: 0}, {Level: 2, Title: "Setext", Offset: 24}} {
+		if heading := doc.Headings[i]; *heading != *expected {
+			t.Errorf("expected heading %+v, got %+v", expected, heading)
+		}
+	}
+	if runes := []rune(doc.Text); string(runes[24:30]) != "Setext" {
+		t.Errorf("unexpected heading offset in %q", doc.Text)
+	}
+}
+
+func TestExtractHtml(t *testing.T) {
+	doc, err := Extract("page.html", []byte(`<html><head><title>t</title><style>p{}</style></head><body>
+<h1>Title</h1><p>Hello   <b>world</b></p><script>alert(1)</script><div>Second<br>line</div>
+<table><tr><td>a</td><td>b</td></tr></table></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Title\n\nHello world\n\nSecond\nline\n\na\tb"; doc.Text != expected {
+		t.Errorf("expected %q, got %q", expected, doc.Text)
+	}
+	if len(doc.Headings) != 1 || doc.Headings[0].Title != "Title" || doc.Headings[0].Level != 1 {
+		t.Errorf("unexpected headings %+v", doc.Headings)
+	}
+}
+
+func TestExtractDocx(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	file, _ := writer.Create("word/document.xml")
+	file.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>Chapter</w:t></w:r></w:p>
+<w:p><w:pPr><w:tabs><w:tab w:val="left"/></w:tabs></w:pPr><w:r><w:t>Hello</w:t><w:tab/><w:t>world</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>a</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>b</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`))
+	writer.Close()
+
+	doc, err := Extract("file.docx", buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Chapter\n\nHello\tworld\n\na\tb"; doc.Text != expected {
+		t.Errorf("expected %q, got %q", expected, doc.Text)
+	}
+	if len(doc.Headings) != 1 || doc.Headings[0].Level != 2 {
+		t.Errorf("unexpected headings %+v", doc.Headings)
+	}
+	if _, err := Extract("file.docx", []byte("not a zip")); err == nil {
+		t.Error("expected error for invalid docx")
+	}
+}
+
+// 构造包含两页的最小 PDF，第二页使用压缩流及 ToUnicode 映射
+func testPdf() []byte {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write([]byte("BT /F1 12 Tf 72 720 Td <00000001> Tj ET"))
+	writer.Close()
+	cmap := "begincmap\n1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"1 beginbfrange <0000> <0001> <4E2D> endbfrange\nendcmap"
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 7 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [6 0 R] >>",
+		"",
+		"",
+		"<< /Type /Font /Subtype /Type0 /ToUnicode 8 0 R >>",
+		"",
+	}
+	streams := map[int][]byte{
+		5: []byte("BT /F2 12 Tf 72 720 Td (Hello) Tj [(Wor) -50 (ld)] TJ 0 -14 Td (Line \\(2\\)) Tj ET"),
+		6: compressed.Bytes(),
+		8: []byte(cmap),
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	for i, object := range objects {
+		number := i + 1
+		fmt.Fprintf(&buf, "%d 0 obj\n", number)
+		if stream, ok := streams[number]; ok {
+			filter := ""
+			if number == 6 {
+				filter = " /Filter /FlateDecode"
+			}
+			fmt.Fprintf(&buf, "<< /Length %d%s >>\nstream\n", len(stream), filter)
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		} else {
+			buf.WriteString(object + "\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R /Size 9 >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func TestExtractPdf(t *testing.T) {
+	doc, err := Extract("file.pdf", testPdf())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "HelloWorld\nLine (2)\n\n中丮"; doc.Text != expected {
+		t.Errorf("expected %q, got %q", expected, doc.Text)
+	}
+	if len(doc.Pages) != 2 || doc.Pages[0].Offset != 0 || doc.Pages[1].Number != 2 ||
+		doc.Pages[1].Offset != len([]rune(doc.Text))-2 {
+		t.Errorf("unexpected pages %+v", doc.Pages)
+	}
+	if _, err := Extract("file.pdf", []byte("plain text")); err == nil || !strings.Contains(err.Error(), "pdf") {
+		t.Errorf("expected invalid pdf error, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package document
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const FormatDocx = "docx"
+
+func init() {
+	Register(".docx", ExtractorFunc(extractDocx))
+}
+
+// docx 为 zip 压缩包，正文位于 word/document.xml
+// 段落样式为 Heading1~Heading9、Title 或设置了大纲级别的段落作为标题
+func extractDocx(data []byte) (*Document, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var file *zip.File
+	for _, f := range reader.File {
+		if f.Name == "word/document.xml" {
+			file = f
+			break
+		}
+	}
+	if file == nil {
+		return nil, errors.New("invalid docx: word/document.xml not found")
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	b := &builder{}
+	decoder := xml.NewDecoder(rc)
+	var paragraph, row strings.Builder
+	// 当前段落的标题级别，0 表示正文
+	level := 0
+	// 段落属性中也有 tab 元素，只处理文本块中的制表符及换行
+	inRun, inText := false, false
+	// 表格中的段落按行合并，单元格之间以制表符分隔
+	tables := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				paragraph.Reset()
+				level = 0
+			case "pStyle":
+				if l := docxHeadingLevel(xmlAttr(t, "val")); l > 0 {
+					level = l
+				}
+			case "outlineLvl":
+				if l, err := strconv.Atoi(xmlAttr(t, "val")); err == nil && l < 9 && level == 0 {
+					level = l + 1
+				}
+			case "r":
+				inRun = true
+			case "t":
+				inText = true
+			case "tbl":
+				tables++
+			case "tab":
+				if inRun {
+					paragraph.WriteString("\t")
+				}
+			case "br", "cr":
+				if inRun {
+					paragraph.WriteString("\n")
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "r":
+				inRun = false
+			case "t":
+				inText = false
+			case "p":
+				if tables > 0 {
+					if row.Len() > 0 && !strings.HasSuffix(row.String(), "\t") {
+						row.WriteString(" ")
+					}
+					row.WriteString(strings.TrimSpace(paragraph.String()))
+				} else if level > 0 {
+					b.heading(level, paragraph.String())
+				} else {
+					b.paragraph(paragraph.String())
+				}
+				paragraph.Reset()
+			case "tc":
+				row.WriteString("\t")
+			case "tr":
+				b.paragraph(strings.TrimRight(row.String(), "\t"))
+				row.Reset()
+			case "tbl":
+				tables--
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+	return b.document(FormatDocx), nil
+}
+
+func docxHeadingLevel(style string) int {
+	style = strings.ToLower(strings.ReplaceAll(style, " ", ""))
+	if style == "title" {
+		return 1
+	}
+	if strings.HasPrefix(style, "heading") {
+		if level, err := strconv.Atoi(strings.TrimPrefix(style, "heading")); err == nil && level > 0 && level < 10 {
+			return level
+		}
+	}
+	return 0
+}
+
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
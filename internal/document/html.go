@@ -0,0 +1,100 @@
+package document
+
+import (
+	"bytes"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"strings"
+)
+
+const FormatHtml = "html"
+
+func init() {
+	for _, ext := range []string{".html", ".htm", ".xhtml"} {
+		Register(ext, ExtractorFunc(extractHtml))
+	}
+}
+
+// 块级元素，元素前后分段
+var htmlBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "dd": true, "div": true, "dl": true,
+	"dt": true, "fieldset": true, "figcaption": true, "figure": true, "footer": true, "form": true, "header": true,
+	"hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "tr": true, "ul": true,
+}
+
+var htmlHeadingLevels = map[string]int{"h1": 1, "h2": 2, "h3": 3, "h4": 4, "h5": 5, "h6": 6}
+
+func extractHtml(data []byte) (*Document, error) {
+	root, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	root.Find("script, style, noscript, template, iframe, svg, head").Remove()
+
+	b := &builder{}
+	var paragraph strings.Builder
+	flush := func() {
+		b.paragraph(paragraph.String())
+		paragraph.Reset()
+	}
+	var walk func(node *html.Node, pre bool)
+	walk = func(node *html.Node, pre bool) {
+		switch node.Type {
+		case html.TextNode:
+			if pre {
+				paragraph.WriteString(node.Data)
+			} else {
+				paragraph.WriteString(collapseSpace(node.Data))
+			}
+			return
+		case html.ElementNode:
+			if level, ok := htmlHeadingLevels[node.Data]; ok {
+				flush()
+				b.heading(level, goquery.NewDocumentFromNode(node).Text())
+				return
+			}
+			switch node.Data {
+			case "br":
+				paragraph.WriteString("\n")
+				return
+			case "td", "th":
+				paragraph.WriteString("\t")
+			}
+		}
+		block := node.Type == html.ElementNode && htmlBlockElements[node.Data]
+		if block {
+			flush()
+		}
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			walk(child, pre || node.Data == "pre")
+		}
+		if block {
+			flush()
+		}
+	}
+	for _, node := range root.Nodes {
+		walk(node, false)
+	}
+	flush()
+	return b.document(FormatHtml), nil
+}
+
+// 合并连续空白，保留首尾的单个空格以分隔相邻的行内元素
+func collapseSpace(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		if text != "" {
+			return " "
+		}
+		return ""
+	}
+	result := strings.Join(fields, " ")
+	if strings.TrimLeft(text, " \t\r\n") != text {
+		result = " " + result
+	}
+	if strings.TrimRight(text, " \t\r\n") != text {
+		result += " "
+	}
+	return result
+}
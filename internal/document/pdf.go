@@ -0,0 +1,820 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const FormatPdf = "pdf"
+
+func init() {
+	Register(".pdf", ExtractorFunc(extractPdf))
+}
+
+var (
+	pdfObjectRegexp   = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	pdfRefRegexp      = regexp.MustCompile(`^(\d+)\s+\d+\s+R\b`)
+	pdfRefsRegexp     = regexp.MustCompile(`(\d+)\s+\d+\s+R\b`)
+	pdfFontRegexp     = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s*(\d+\s+\d+\s+R|<<)`)
+	pdfRootRegexp     = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R\b`)
+	pdfTypePageRegexp = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfTypePagesRegex = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfLengthRegexp   = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+)
+
+// 文本与数字之间的间距超过该值时视为单词间的空格，单位为千分之一字号
+const pdfSpaceThreshold = 200
+
+// PDF 中的对象，dict 为对象的字典或值部分，stream 为解码后的流内容
+type pdfObject struct {
+	dict   []byte
+	raw    []byte
+	stream []byte
+	// 流是否已解码
+	decoded bool
+}
+
+type pdfFile struct {
+	objects map[int]*pdfObject
+	// 字体的 ToUnicode 映射，以字体对象编号为键
+	cmaps map[string]*pdfCMap
+}
+
+// 提取基于文本的 PDF 内容，不支持加密文档及扫描件
+// 文字编码优先使用字体的 ToUnicode 映射，没有映射时按单字节编码处理
+func extractPdf(data []byte) (*Document, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF")) {
+		return nil, errors.New("invalid pdf file")
+	}
+	file := &pdfFile{objects: make(map[int]*pdfObject), cmaps: make(map[string]*pdfCMap)}
+	file.parseObjects(data)
+	for _, object := range file.objects {
+		if bytes.Contains(object.dict, []byte("/Filter")) && bytes.Contains(object.dict, []byte("/Standard")) &&
+			bytes.Contains(object.dict, []byte("/O")) && bytes.Contains(object.dict, []byte("/U")) {
+			return nil, errors.New("encrypted pdf is not supported")
+		}
+	}
+
+	b := &builder{}
+	pages := file.pages(data)
+	if len(pages) == 0 {
+		// 无法解析页面结构时提取所有包含文本的内容流
+		for _, number := range sortedKeys(file.objects) {
+			object := file.objects[number]
+			if content := file.stream(object); bytes.Contains(content, []byte("BT")) {
+				b.paragraph(file.text(content, nil))
+			}
+		}
+		return b.document(FormatPdf), nil
+	}
+	for _, page := range pages {
+		b.newPage()
+		var content bytes.Buffer
+		for _, number := range page.contents {
+			if object, ok := file.objects[number]; ok {
+				content.Write(file.stream(object))
+				content.WriteByte('\n')
+			}
+		}
+		b.paragraph(file.text(content.Bytes(), page.fonts))
+	}
+	return b.document(FormatPdf), nil
+}
+
+// 解析所有间接对象，包括对象流中的对象
+func (f *pdfFile) parseObjects(data []byte) {
+	matches := pdfObjectRegexp.FindAllSubmatchIndex(data, -1)
+	end := 0
+	for _, match := range matches {
+		// 跳过流内容中偶然出现的对象标记
+		if match[0] < end {
+			continue
+		}
+		number, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		body := data[match[1]:]
+		object := &pdfObject{}
+		objectEnd := bytes.Index(body, []byte("endobj"))
+		streamStart := bytes.Index(body, []byte("stream"))
+		if streamStart >= 0 && (objectEnd < 0 || streamStart < objectEnd) {
+			object.dict = bytes.TrimSpace(body[:streamStart])
+			start := streamStart + len("stream")
+			if start < len(body) && body[start] == '\r' {
+				start++
+			}
+			if start < len(body) && body[start] == '\n' {
+				start++
+			}
+			length := -1
+			if m := pdfLengthRegexp.FindSubmatch(object.dict); m != nil && len(m[2]) == 0 {
+				length, _ = strconv.Atoi(string(m[1]))
+			}
+			if length >= 0 && start+length <= len(body) &&
+				bytes.HasPrefix(bytes.TrimLeft(body[start+length:], "\r\n "), []byte("endstream")) {
+				object.raw = body[start : start+length]
+			} else if streamEnd := bytes.Index(body[start:], []byte("endstream")); streamEnd >= 0 {
+				object.raw = bytes.TrimRight(body[start:start+streamEnd], "\r\n")
+			} else {
+				object.raw = body[start:]
+			}
+			end = match[1] + start + len(object.raw)
+		} else if objectEnd >= 0 {
+			object.dict = bytes.TrimSpace(body[:objectEnd])
+			end = match[1] + objectEnd
+		} else {
+			object.dict = bytes.TrimSpace(body)
+			end = len(data)
+		}
+		f.objects[number] = object
+	}
+	// 对象流中的对象
+	for _, number := range sortedKeys(f.objects) {
+		object := f.objects[number]
+		if !bytes.Contains(object.dict, []byte("/ObjStm")) {
+			continue
+		}
+		f.parseObjectStream(object)
+	}
+}
+
+func (f *pdfFile) parseObjectStream(object *pdfObject) {
+	content := f.stream(object)
+	count := pdfInt(object.dict, "/N")
+	first := pdfInt(object.dict, "/First")
+	if count <= 0 || first <= 0 || first > len(content) {
+		return
+	}
+	fields := strings.Fields(string(content[:first]))
+	if len(fields) < count*2 {
+		return
+	}
+	offsets := make([]int, count)
+	numbers := make([]int, count)
+	for i := 0; i < count; i++ {
+		numbers[i], _ = strconv.Atoi(fields[i*2])
+		offsets[i], _ = strconv.Atoi(fields[i*2+1])
+	}
+	for i := 0; i < count; i++ {
+		start := first + offsets[i]
+		end := len(content)
+		if i+1 < count {
+			end = first + offsets[i+1]
+		}
+		if start > end || end > len(content) {
+			continue
+		}
+		if _, ok := f.objects[numbers[i]]; !ok {
+			f.objects[numbers[i]] = &pdfObject{dict: bytes.TrimSpace(content[start:end])}
+		}
+	}
+}
+
+// 解码流内容，只支持 FlateDecode 及未压缩的流
+func (f *pdfFile) stream(object *pdfObject) []byte {
+	if object.decoded {
+		return object.stream
+	}
+	object.decoded = true
+	if object.raw == nil {
+		return nil
+	}
+	filter := pdfValue(object.dict, "/Filter")
+	switch {
+	case len(filter) == 0:
+		object.stream = object.raw
+	case bytes.Equal(bytes.Trim(filter, "[] \r\n"), []byte("/FlateDecode")):
+		reader, err := zlib.NewReader(bytes.NewReader(object.raw))
+		if err != nil {
+			return nil
+		}
+		// 部分文件的压缩流末尾不完整，保留已解压的内容
+		content, _ := io.ReadAll(reader)
+		object.stream = content
+	}
+	return object.stream
+}
+
+type pdfPage struct {
+	contents []int
+	fonts    map[string]*pdfCMap
+}
+
+// 按页面树的顺序获取页面
+func (f *pdfFile) pages(data []byte) []*pdfPage {
+	var root int
+	if matches := pdfRootRegexp.FindAllSubmatch(data, -1); len(matches) > 0 {
+		// 增量更新的文件以最后的 Root 为准
+		root, _ = strconv.Atoi(string(matches[len(matches)-1][1]))
+	}
+	catalog, ok := f.objects[root]
+	if !ok {
+		return nil
+	}
+	pagesRef, ok := pdfRef(pdfValue(catalog.dict, "/Pages"))
+	if !ok {
+		return nil
+	}
+	var pages []*pdfPage
+	visited := make(map[int]bool)
+	var walk func(number int, resources []byte)
+	walk = func(number int, resources []byte) {
+		object, ok := f.objects[number]
+		if !ok || visited[number] {
+			return
+		}
+		visited[number] = true
+		if value := f.resolve(pdfValue(object.dict, "/Resources")); len(value) > 0 {
+			resources = value
+		}
+		if pdfTypePagesRegex.Match(object.dict) || !pdfTypePageRegexp.Match(object.dict) {
+			for _, kid := range pdfRefs(f.resolve(pdfValue(object.dict, "/Kids"))) {
+				walk(kid, resources)
+			}
+			return
+		}
+		page := &pdfPage{fonts: f.fonts(resources)}
+		contents := pdfValue(object.dict, "/Contents")
+		if number, ok := pdfRef(contents); ok {
+			// 内容可能是指向数组的间接引用
+			if target, ok := f.objects[number]; ok && bytes.HasPrefix(target.dict, []byte("[")) {
+				contents = target.dict
+			}
+		}
+		page.contents = pdfRefs(contents)
+		pages = append(pages, page)
+	}
+	walk(pagesRef, nil)
+	return pages
+}
+
+// 解析资源中字体的 ToUnicode 映射，以资源中的字体名称为键
+func (f *pdfFile) fonts(resources []byte) map[string]*pdfCMap {
+	fonts := make(map[string]*pdfCMap)
+	dict := f.resolve(pdfValue(resources, "/Font"))
+	if len(dict) == 0 {
+		return fonts
+	}
+	dict = bytes.TrimSuffix(bytes.TrimPrefix(bytes.TrimSpace(dict), []byte("<<")), []byte(">>"))
+	for _, match := range pdfFontRegexp.FindAllSubmatchIndex(dict, -1) {
+		name := string(dict[match[2]:match[3]])
+		font := f.resolve(pdfValue(dict, "/"+name))
+		toUnicode, ok := pdfRef(pdfValue(font, "/ToUnicode"))
+		if !ok {
+			continue
+		}
+		key := strconv.Itoa(toUnicode)
+		cmap, ok := f.cmaps[key]
+		if !ok {
+			if object, exists := f.objects[toUnicode]; exists {
+				cmap = parseCMap(f.stream(object))
+			}
+			f.cmaps[key] = cmap
+		}
+		if cmap != nil {
+			fonts[name] = cmap
+		}
+	}
+	return fonts
+}
+
+// 解析间接引用，非引用时原样返回
+func (f *pdfFile) resolve(value []byte) []byte {
+	for i := 0; i < 8; i++ {
+		number, ok := pdfRef(value)
+		if !ok {
+			return value
+		}
+		object, exists := f.objects[number]
+		if !exists {
+			return nil
+		}
+		value = object.dict
+	}
+	return value
+}
+
+// 提取内容流中的文本，按文本位置的变化换行
+func (f *pdfFile) text(content []byte, fonts map[string]*pdfCMap) string {
+	var text strings.Builder
+	lexer := &pdfLexer{data: content}
+	var operands []pdfToken
+	var cmap *pdfCMap
+	newline := func() {
+		if text.Len() > 0 && !strings.HasSuffix(text.String(), "\n") {
+			text.WriteString("\n")
+		}
+	}
+	space := func() {
+		if s := text.String(); len(s) > 0 && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			text.WriteString(" ")
+		}
+	}
+	show := func(token pdfToken) {
+		if token.kind == pdfTokenString {
+			text.WriteString(decodePdfString(token.value, cmap))
+		}
+	}
+	number := func(index int) float64 {
+		if index < 0 || index >= len(operands) {
+			return 0
+		}
+		value, _ := strconv.ParseFloat(string(operands[index].value), 64)
+		return value
+	}
+	lineY, hasLine := 0.0, false
+	for {
+		token, ok := lexer.next()
+		if !ok {
+			break
+		}
+		if token.kind != pdfTokenOperator {
+			operands = append(operands, token)
+			continue
+		}
+		switch string(token.value) {
+		case "Tf":
+			if len(operands) >= 2 {
+				cmap = fonts[strings.TrimPrefix(string(operands[len(operands)-2].value), "/")]
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "'":
+			newline()
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "\"":
+			newline()
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "TJ":
+			for _, operand := range operands {
+				if operand.kind == pdfTokenNumber {
+					if value, _ := strconv.ParseFloat(string(operand.value), 64); value < -pdfSpaceThreshold {
+						space()
+					}
+					continue
+				}
+				show(operand)
+			}
+		case "Td", "TD":
+			if ty := number(len(operands) - 1); ty != 0 {
+				newline()
+			} else if number(len(operands)-2) > 0 {
+				space()
+			}
+		case "T*":
+			newline()
+		case "Tm":
+			if y := number(len(operands) - 1); hasLine && y != lineY {
+				newline()
+			} else if hasLine {
+				space()
+			}
+			lineY, hasLine = number(len(operands)-1), true
+		case "BT":
+			hasLine = false
+		case "ET":
+			space()
+		}
+		operands = operands[:0]
+	}
+	return text.String()
+}
+
+const (
+	pdfTokenOperator = iota
+	pdfTokenNumber
+	pdfTokenString
+	pdfTokenName
+	pdfTokenOther
+)
+
+type pdfToken struct {
+	kind  int
+	value []byte
+}
+
+// 内容流的词法分析，数组中的元素作为独立的操作数返回
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *pdfLexer) next() (pdfToken, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPdfSpace(c) || c == '[' || c == ']':
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return pdfToken{kind: pdfTokenString, value: l.literal()}, true
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+			l.pos += 2
+			return pdfToken{kind: pdfTokenOther, value: []byte("<<")}, true
+		case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+			l.pos += 2
+			return pdfToken{kind: pdfTokenOther, value: []byte(">>")}, true
+		case c == '<':
+			end := bytes.IndexByte(l.data[l.pos:], '>')
+			if end < 0 {
+				end = len(l.data) - l.pos
+			}
+			value := l.data[l.pos+1 : l.pos+end]
+			l.pos += end + 1
+			return pdfToken{kind: pdfTokenString, value: decodePdfHex(value)}, true
+		case c == '/':
+			start := l.pos
+			l.pos++
+			for l.pos < len(l.data) && !isPdfSpace(l.data[l.pos]) && !isPdfDelimiter(l.data[l.pos]) {
+				l.pos++
+			}
+			return pdfToken{kind: pdfTokenName, value: l.data[start:l.pos]}, true
+		default:
+			start := l.pos
+			for l.pos < len(l.data) && !isPdfSpace(l.data[l.pos]) && !isPdfDelimiter(l.data[l.pos]) {
+				l.pos++
+			}
+			if l.pos == start {
+				l.pos++
+				continue
+			}
+			value := l.data[start:l.pos]
+			if _, err := strconv.ParseFloat(string(value), 64); err == nil {
+				return pdfToken{kind: pdfTokenNumber, value: value}, true
+			}
+			if string(value) == "ID" {
+				l.skipInlineImage()
+				continue
+			}
+			return pdfToken{kind: pdfTokenOperator, value: value}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+// 读取字面量字符串，处理转义及嵌套括号
+func (l *pdfLexer) literal() []byte {
+	var value []byte
+	depth := 0
+	l.pos++
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '\\':
+			if l.pos >= len(l.data) {
+				return value
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				value = append(value, '\n')
+			case 'r':
+				value = append(value, '\r')
+			case 't':
+				value = append(value, '\t')
+			case 'b':
+				value = append(value, '\b')
+			case 'f':
+				value = append(value, '\f')
+			case '\r', '\n':
+				// 续行
+				if e == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			default:
+				if e >= '0' && e <= '7' {
+					code := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						code = code*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					value = append(value, byte(code))
+				} else {
+					value = append(value, e)
+				}
+			}
+		case '(':
+			depth++
+			value = append(value, c)
+		case ')':
+			if depth == 0 {
+				return value
+			}
+			depth--
+			value = append(value, c)
+		default:
+			value = append(value, c)
+		}
+	}
+	return value
+}
+
+// 跳过内联图片数据，数据以 EI 结束
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos+2 < len(l.data) {
+		if isPdfSpace(l.data[l.pos]) && l.data[l.pos+1] == 'E' && l.data[l.pos+2] == 'I' &&
+			(l.pos+3 == len(l.data) || isPdfSpace(l.data[l.pos+3])) {
+			l.pos += 3
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
+
+func isPdfSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPdfDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func decodePdfHex(value []byte) []byte {
+	value = bytes.Map(func(r rune) rune {
+		if isPdfSpace(byte(r)) {
+			return -1
+		}
+		return r
+	}, value)
+	if len(value)%2 == 1 {
+		value = append(value, '0')
+	}
+	decoded, err := hex.DecodeString(string(value))
+	if err != nil {
+		return nil
+	}
+	return decoded
+}
+
+// 解码字符串，有 ToUnicode 映射时按映射解码，否则按 UTF-16 或单字节编码处理
+func decodePdfString(value []byte, cmap *pdfCMap) string {
+	if cmap != nil {
+		return cmap.decode(value)
+	}
+	if len(value) >= 2 && value[0] == 0xfe && value[1] == 0xff {
+		return decodeUtf16(value[2:])
+	}
+	runes := make([]rune, len(value))
+	for i, c := range value {
+		runes[i] = pdfByteRune(c)
+	}
+	return string(runes)
+}
+
+// 单字节编码按 WinAnsiEncoding 处理，与 Latin-1 的差异只在 0x80~0x9F
+var winAnsiRunes = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ', 0x89: '‰',
+	0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•',
+	0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+func pdfByteRune(c byte) rune {
+	if r, ok := winAnsiRunes[c]; ok {
+		return r
+	}
+	return rune(c)
+}
+
+func decodeUtf16(value []byte) string {
+	units := make([]uint16, len(value)/2)
+	for i := range units {
+		units[i] = uint16(value[i*2])<<8 | uint16(value[i*2+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+// pdfCMap ToUnicode 映射，字符编码长度为 1~4 字节
+type pdfCMap struct {
+	mapping map[string]string
+	// 编码长度，按从长到短尝试
+	lengths []int
+}
+
+var (
+	cmapCodespaceRegexp = regexp.MustCompile(`(?s)begincodespacerange(.*?)endcodespacerange`)
+	cmapBfcharRegexp    = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	cmapBfrangeRegexp   = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	cmapHexRegexp       = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>`)
+	cmapRangeRegexp     = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*(<[0-9A-Fa-f\s]*>|\[[^\]]*\])`)
+)
+
+func parseCMap(content []byte) *pdfCMap {
+	if len(content) == 0 {
+		return nil
+	}
+	cmap := &pdfCMap{mapping: make(map[string]string)}
+	lengths := make(map[int]bool)
+	for _, block := range cmapCodespaceRegexp.FindAllSubmatch(content, -1) {
+		for _, code := range cmapHexRegexp.FindAllSubmatch(block[1], -1) {
+			lengths[len(decodePdfHex(code[1]))] = true
+		}
+	}
+	for _, block := range cmapBfcharRegexp.FindAllSubmatch(content, -1) {
+		codes := cmapHexRegexp.FindAllSubmatch(block[1], -1)
+		for i := 0; i+1 < len(codes); i += 2 {
+			src := decodePdfHex(codes[i][1])
+			cmap.mapping[string(src)] = decodeUtf16(decodePdfHex(codes[i+1][1]))
+			lengths[len(src)] = true
+		}
+	}
+	for _, block := range cmapBfrangeRegexp.FindAllSubmatch(content, -1) {
+		for _, match := range cmapRangeRegexp.FindAllSubmatch(block[1], -1) {
+			low, high := decodePdfHex(match[1]), decodePdfHex(match[2])
+			if len(low) != len(high) || len(low) == 0 || len(low) > 4 {
+				continue
+			}
+			lengths[len(low)] = true
+			start, end := pdfCode(low), pdfCode(high)
+			if end < start || end-start > 0xffff {
+				continue
+			}
+			var targets [][]byte
+			if match[3][0] == '[' {
+				for _, target := range cmapHexRegexp.FindAllSubmatch(match[3], -1) {
+					targets = append(targets, decodePdfHex(target[1]))
+				}
+			}
+			base := decodePdfHex(bytes.Trim(match[3], "<>"))
+			for code := start; code <= end; code++ {
+				offset := int(code - start)
+				var target []byte
+				if targets != nil {
+					if offset >= len(targets) {
+						break
+					}
+					target = targets[offset]
+				} else {
+					// 目标编码的最后一个字节随源编码递增
+					target = append([]byte(nil), base...)
+					if len(target) > 0 {
+						value := int(target[len(target)-1]) + offset
+						target[len(target)-1] = byte(value)
+						if len(target) > 1 {
+							target[len(target)-2] += byte(value >> 8)
+						}
+					}
+				}
+				cmap.mapping[string(pdfCodeBytes(code, len(low)))] = decodeUtf16(target)
+			}
+		}
+	}
+	if len(cmap.mapping) == 0 {
+		return nil
+	}
+	for length := 4; length >= 1; length-- {
+		if lengths[length] {
+			cmap.lengths = append(cmap.lengths, length)
+		}
+	}
+	return cmap
+}
+
+func (c *pdfCMap) decode(value []byte) string {
+	var text strings.Builder
+	for i := 0; i < len(value); {
+		matched := false
+		for _, length := range c.lengths {
+			if i+length > len(value) {
+				continue
+			}
+			if target, ok := c.mapping[string(value[i:i+length])]; ok {
+				text.WriteString(target)
+				i += length
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			// 无法映射的编码按最短编码长度跳过
+			i += c.lengths[len(c.lengths)-1]
+		}
+	}
+	return text.String()
+}
+
+func pdfCode(value []byte) uint32 {
+	var code uint32
+	for _, c := range value {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func pdfCodeBytes(code uint32, length int) []byte {
+	value := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		value[i] = byte(code)
+		code >>= 8
+	}
+	return value
+}
+
+// 获取字典中指定键的值，值为字典或数组时包含完整的括号内容
+func pdfValue(dict []byte, key string) []byte {
+	index := 0
+	for {
+		i := bytes.Index(dict[index:], []byte(key))
+		if i < 0 {
+			return nil
+		}
+		index += i + len(key)
+		// 键名需要完整匹配，如 /Font 不匹配 /FontDescriptor
+		if index < len(dict) && !isPdfSpace(dict[index]) && !isPdfDelimiter(dict[index]) {
+			continue
+		}
+		break
+	}
+	rest := bytes.TrimLeft(dict[index:], " \t\r\n\f")
+	if len(rest) == 0 {
+		return nil
+	}
+	if match := pdfRefRegexp.Find(rest); match != nil {
+		return match
+	}
+	switch {
+	case bytes.HasPrefix(rest, []byte("<<")):
+		return pdfBalanced(rest, "<<", ">>")
+	case rest[0] == '[':
+		return pdfBalanced(rest, "[", "]")
+	}
+	end := 1
+	for end < len(rest) && !isPdfSpace(rest[end]) && !isPdfDelimiter(rest[end]) {
+		end++
+	}
+	return rest[:end]
+}
+
+// 截取成对括号包围的内容
+func pdfBalanced(data []byte, open, close string) []byte {
+	depth := 0
+	for i := 0; i < len(data); {
+		switch {
+		case bytes.HasPrefix(data[i:], []byte(open)):
+			depth++
+			i += len(open)
+		case bytes.HasPrefix(data[i:], []byte(close)):
+			depth--
+			i += len(close)
+			if depth == 0 {
+				return data[:i]
+			}
+		default:
+			i++
+		}
+	}
+	return data
+}
+
+func pdfRef(value []byte) (int, bool) {
+	match := pdfRefRegexp.FindSubmatch(bytes.TrimSpace(value))
+	if match == nil {
+		return 0, false
+	}
+	number, err := strconv.Atoi(string(match[1]))
+	return number, err == nil
+}
+
+func pdfRefs(value []byte) []int {
+	var numbers []int
+	for _, match := range pdfRefsRegexp.FindAllSubmatch(value, -1) {
+		if number, err := strconv.Atoi(string(match[1])); err == nil {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
+
+func pdfInt(dict []byte, key string) int {
+	value, _ := strconv.Atoi(string(pdfValue(dict, key)))
+	return value
+}
+
+func sortedKeys(objects map[int]*pdfObject) []int {
+	keys := make([]int, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	for i := 1; i < len(keys); i++ {
+		for j := i; j > 0 && keys[j] < keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+		}
+	}
+	return keys
+}
@@ -0,0 +1,83 @@
+package document
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	FormatText     = "text"
+	FormatMarkdown = "markdown"
+)
+
+func init() {
+	for _, ext := range []string{".txt", ".text", ".log", ".csv", ".json", ".xml", ".yaml", ".yml"} {
+		Register(ext, ExtractorFunc(extractText))
+	}
+	for _, ext := range []string{".md", ".markdown"} {
+		Register(ext, ExtractorFunc(extractMarkdown))
+	}
+}
+
+func extractText(data []byte) (*Document, error) {
+	return &Document{
+		Format: FormatText,
+		Text:   Normalize(string(data)),
+	}, nil
+}
+
+var (
+	// ATX 标题，如 ## 标题
+	markdownHeadingRegexp = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+	// Setext 标题的下划线，= 为一级标题，- 为二级标题
+	markdownUnderlineRegexp = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	markdownFenceRegexp     = regexp.MustCompile("^ {0,3}(```|~~~)")
+)
+
+// Markdown 保留原始文本，标题位置按规范化后的文本计算，代码块中的内容不作为标题
+func extractMarkdown(data []byte) (*Document, error) {
+	text := Normalize(string(data))
+	doc := &Document{
+		Format: FormatMarkdown,
+		Text:   text,
+	}
+	lines := strings.Split(text, "\n")
+	offset := 0
+	fence := ""
+	for i, line := range lines {
+		lineOffset := offset
+		offset += len([]rune(line)) + 1
+		if match := markdownFenceRegexp.FindStringSubmatch(line); match != nil {
+			if fence == "" {
+				fence = match[1]
+			} else if fence == match[1] {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		if match := markdownHeadingRegexp.FindStringSubmatch(line); match != nil {
+			if title := strings.TrimSpace(match[2]); title != "" {
+				doc.Headings = append(doc.Headings, &Heading{Level: len(match[1]), Title: title, Offset: lineOffset})
+			}
+			continue
+		}
+		if i > 0 && strings.TrimSpace(lines[i-1]) != "" && !markdownHeadingRegexp.MatchString(lines[i-1]) {
+			if match := markdownUnderlineRegexp.FindStringSubmatch(line); match != nil {
+				level := 1
+				if match[1][0] == '-' {
+					level = 2
+				}
+				previous := lines[i-1]
+				doc.Headings = append(doc.Headings, &Heading{
+					Level:  level,
+					Title:  strings.TrimSpace(previous),
+					Offset: lineOffset - len([]rune(previous)) - 1,
+				})
+			}
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,487 @@
+// Package jsonschema 提供 JSON Schema 常用关键字的校验，用于校验模型的结构化输出
+//
+// 支持的关键字：type、enum、const、properties、required、additionalProperties、items、
+// minItems、maxItems、uniqueItems、minLength、maxLength、pattern、minimum、maximum、
+// exclusiveMinimum、exclusiveMaximum、multipleOf、allOf、anyOf、oneOf、not 以及文档内部的 $ref 引用，
+// 其余关键字会被忽略。
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// 引用解析的最大深度，避免循环引用
+const maxRefDepth = 32
+
+// Schema 已解析的 JSON Schema
+type Schema struct {
+	root     interface{}
+	patterns map[string]*regexp.Regexp
+}
+
+// ValidationError 校验失败的位置与原因
+type ValidationError struct {
+	// 校验失败的值所在位置，使用 JSON Pointer 表示，根节点为空字符串
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// Parse 解析 JSON Schema，schema 必须为对象或布尔值
+func Parse(data []byte) (*Schema, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	switch root.(type) {
+	case map[string]interface{}, bool:
+	default:
+		return nil, errors.New("schema must be an object or a boolean")
+	}
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compile(root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// 预编译 schema 中的正则表达式
+func (s *Schema) compile(node interface{}) error {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if pattern, ok := node["pattern"].(string); ok {
+			if _, ok := s.patterns[pattern]; !ok {
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+				}
+				s.patterns[pattern] = re
+			}
+		}
+		for _, child := range node {
+			if err := s.compile(child); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, child := range node {
+			if err := s.compile(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateJSON 解析 JSON 文本并校验，返回解析后的值
+func (s *Schema) ValidateJSON(data []byte) (interface{}, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected content after json value")
+	}
+	return value, s.Validate(value)
+}
+
+// Validate 校验已解析的值，数字可以为 float64 或 json.Number
+func (s *Schema) Validate(value interface{}) error {
+	return s.validate(s.root, value, "", 0)
+}
+
+func (s *Schema) validate(node interface{}, value interface{}, path string, depth int) error {
+	schema, ok := node.(map[string]interface{})
+	if !ok {
+		if allowed, ok := node.(bool); ok && !allowed {
+			return &ValidationError{Path: path, Message: "value is not allowed"}
+		}
+		return nil
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		if depth >= maxRefDepth {
+			return &ValidationError{Path: path, Message: "too many nested references"}
+		}
+		target, err := s.resolve(ref)
+		if err != nil {
+			return err
+		}
+		if err := s.validate(target, value, path, depth+1); err != nil {
+			return err
+		}
+	}
+
+	if types, ok := schema["type"]; ok {
+		if err := validateType(types, value, path); err != nil {
+			return err
+		}
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		matched := false
+		for _, item := range enum {
+			if equal(item, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return &ValidationError{Path: path, Message: "value is not one of the enum values"}
+		}
+	}
+	if constant, ok := schema["const"]; ok && !equal(constant, value) {
+		return &ValidationError{Path: path, Message: "value does not equal the const value"}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if err := s.validateObject(schema, value, path, depth); err != nil {
+			return err
+		}
+	case []interface{}:
+		if err := s.validateArray(schema, value, path, depth); err != nil {
+			return err
+		}
+	case string:
+		if err := s.validateString(schema, value, path); err != nil {
+			return err
+		}
+	case float64, json.Number:
+		if err := validateNumber(schema, toFloat(value), path); err != nil {
+			return err
+		}
+	}
+
+	return s.validateCombinators(schema, value, path, depth)
+}
+
+func (s *Schema) validateObject(schema map[string]interface{}, value map[string]interface{}, path string, depth int) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if name, ok := name.(string); ok {
+				if _, ok := value[name]; !ok {
+					return &ValidationError{Path: path, Message: fmt.Sprintf("missing required property %q", name)}
+				}
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	// 按属性名排序，保证错误信息稳定
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		childPath := path + "/" + escapePointer(name)
+		if property, ok := properties[name]; ok {
+			if err := s.validate(property, value[name], childPath, depth); err != nil {
+				return err
+			}
+			continue
+		}
+		if additional, ok := schema["additionalProperties"]; ok {
+			if allowed, ok := additional.(bool); ok && !allowed {
+				return &ValidationError{Path: path, Message: fmt.Sprintf("additional property %q is not allowed", name)}
+			}
+			if err := s.validate(additional, value[name], childPath, depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateArray(schema map[string]interface{}, value []interface{}, path string, depth int) error {
+	if minItems, ok := toInt(schema["minItems"]); ok && len(value) < minItems {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("array must contain at least %d items", minItems)}
+	}
+	if maxItems, ok := toInt(schema["maxItems"]); ok && len(value) > maxItems {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("array must contain at most %d items", maxItems)}
+	}
+	if unique, ok := schema["uniqueItems"].(bool); ok && unique {
+		for i := 0; i < len(value); i++ {
+			for j := i + 1; j < len(value); j++ {
+				if equal(value[i], value[j]) {
+					return &ValidationError{Path: path, Message: fmt.Sprintf("items %d and %d are not unique", i, j)}
+				}
+			}
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		for i, item := range value {
+			if err := s.validate(items, item, path+"/"+strconv.Itoa(i), depth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateString(schema map[string]interface{}, value string, path string) error {
+	length := utf8.RuneCountInString(value)
+	if minLength, ok := toInt(schema["minLength"]); ok && length < minLength {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("string must be at least %d characters", minLength)}
+	}
+	if maxLength, ok := toInt(schema["maxLength"]); ok && length > maxLength {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("string must be at most %d characters", maxLength)}
+	}
+	if pattern, ok := schema["pattern"].(string); ok && !s.patterns[pattern].MatchString(value) {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("string does not match pattern %q", pattern)}
+	}
+	return nil
+}
+
+func validateNumber(schema map[string]interface{}, value float64, path string) error {
+	if minimum, ok := toNumber(schema["minimum"]); ok && value < minimum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("number must be >= %v", minimum)}
+	}
+	if maximum, ok := toNumber(schema["maximum"]); ok && value > maximum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("number must be <= %v", maximum)}
+	}
+	if minimum, ok := toNumber(schema["exclusiveMinimum"]); ok && value <= minimum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("number must be > %v", minimum)}
+	}
+	if maximum, ok := toNumber(schema["exclusiveMaximum"]); ok && value >= maximum {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("number must be < %v", maximum)}
+	}
+	if multipleOf, ok := toNumber(schema["multipleOf"]); ok && multipleOf > 0 {
+		if quotient := value / multipleOf; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("number must be a multiple of %v", multipleOf)}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateCombinators(schema map[string]interface{}, value interface{}, path string, depth int) error {
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, child := range allOf {
+			if err := s.validate(child, value, path, depth); err != nil {
+				return err
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		var firstErr error
+		for _, child := range anyOf {
+			err := s.validate(child, value, path, depth)
+			if err == nil {
+				firstErr = nil
+				break
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		if firstErr != nil {
+			return &ValidationError{Path: path, Message: "value does not match any schema in anyOf: " + firstErr.Error()}
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		for _, child := range oneOf {
+			if s.validate(child, value, path, depth) == nil {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("value must match exactly one schema in oneOf, matched %d", matched)}
+		}
+	}
+	if not, ok := schema["not"]; ok && s.validate(not, value, path, depth) == nil {
+		return &ValidationError{Path: path, Message: "value must not match the schema in not"}
+	}
+	return nil
+}
+
+func validateType(types interface{}, value interface{}, path string) error {
+	var names []string
+	switch types := types.(type) {
+	case string:
+		names = []string{types}
+	case []interface{}:
+		for _, name := range types {
+			if name, ok := name.(string); ok {
+				names = append(names, name)
+			}
+		}
+	default:
+		return nil
+	}
+	for _, name := range names {
+		if isType(name, value) {
+			return nil
+		}
+	}
+	return &ValidationError{Path: path, Message: fmt.Sprintf("expected %s, got %s", strings.Join(names, " or "), typeName(value))}
+}
+
+func isType(name string, value interface{}) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		switch value.(type) {
+		case float64, json.Number:
+			return true
+		}
+	case "integer":
+		switch value.(type) {
+		case float64, json.Number:
+			number := toFloat(value)
+			return number == math.Trunc(number)
+		}
+	}
+	return false
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	case float64, json.Number:
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// 解析文档内部引用，如 #/$defs/item
+func (s *Schema) resolve(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("unsupported reference %q", ref)
+	}
+	pointer, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid reference %q: %w", ref, err)
+	}
+	node := s.root
+	if pointer == "" {
+		return node, nil
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch current := node.(type) {
+		case map[string]interface{}:
+			child, ok := current[token]
+			if !ok {
+				return nil, fmt.Errorf("reference %q not found", ref)
+			}
+			node = child
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, fmt.Errorf("reference %q not found", ref)
+			}
+			node = current[index]
+		default:
+			return nil, fmt.Errorf("reference %q not found", ref)
+		}
+	}
+	return node, nil
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// 比较两个 JSON 值是否相等，数字按数值比较
+func equal(a, b interface{}) bool {
+	if isNumber(a) && isNumber(b) {
+		return toFloat(a) == toFloat(b)
+	}
+	switch a := a.(type) {
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case float64, json.Number:
+		return true
+	}
+	return false
+}
+
+func toFloat(value interface{}) float64 {
+	switch value := value.(type) {
+	case float64:
+		return value
+	case json.Number:
+		number, _ := value.Float64()
+		return number
+	}
+	return 0
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	if !isNumber(value) {
+		return 0, false
+	}
+	return toFloat(value), true
+}
+
+func toInt(value interface{}) (int, bool) {
+	number, ok := toNumber(value)
+	return int(number), ok
+}
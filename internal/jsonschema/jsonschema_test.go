@@ -0,0 +1,86 @@
+package jsonschema
+
+import (
+	"testing"
+)
+
+const personSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0},
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"tags": {"type": "array", "items": {"$ref": "#/$defs/tag"}, "uniqueItems": true},
+		"role": {"enum": ["admin", "user"]},
+		"address": {"anyOf": [{"type": "null"}, {"$ref": "#/$defs/address"}]}
+	},
+	"required": ["name", "age"],
+	"additionalProperties": false,
+	"$defs": {
+		"tag": {"type": "string", "maxLength": 5},
+		"address": {
+			"type": "object",
+			"properties": {"city": {"type": "string"}},
+			"required": ["city"]
+		}
+	}
+}`
+
+func TestValidateJSON(t *testing.T) {
+	schema, err := Parse([]byte(personSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		data string
+		err  string
+	}{
+		{`{"name": "Tom", "age": 3, "tags": ["a", "b"], "role": "user", "address": {"city": "Beijing"}}`, ""},
+		{`{"name": "Tom", "age": 3, "address": null}`, ""},
+		{`{"name": "Tom"}`, `missing required property "age"`},
+		{`{"name": "Tom", "age": 3.5}`, "/age: expected integer, got number"},
+		{`{"name": "Tom", "age": -1}`, "/age: number must be >= 0"},
+		{`{"name": "", "age": 1}`, "/name: string must be at least 1 characters"},
+		{`{"name": "Tom", "age": 1, "email": "tom"}`, `/email: string does not match pattern "^[^@]+@[^@]+$"`},
+		{`{"name": "Tom", "age": 1, "tags": ["a", "a"]}`, "/tags: items 0 and 1 are not unique"},
+		{`{"name": "Tom", "age": 1, "tags": ["abcdef"]}`, "/tags/0: string must be at most 5 characters"},
+		{`{"name": "Tom", "age": 1, "role": "guest"}`, "/role: value is not one of the enum values"},
+		{`{"name": "Tom", "age": 1, "extra": true}`, `additional property "extra" is not allowed`},
+		{`{"name": "Tom", "age": 1, "address": {}}`, `/address: value does not match any schema in anyOf: /address: expected null, got object`},
+		{`[]`, "expected object, got array"},
+	}
+	for _, c := range cases {
+		_, err := schema.ValidateJSON([]byte(c.data))
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.data, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != c.err {
+			t.Errorf("%s: expected error %q, got %v", c.data, c.err, err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte(`"string"`)); err == nil {
+		t.Error("expected error for string schema")
+	}
+	if _, err := Parse([]byte(`{"pattern": "("}`)); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+	schema, err := Parse([]byte(`{"oneOf": [{"type": "integer"}, {"type": "number", "multipleOf": 0.5}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := schema.ValidateJSON([]byte(`1.5`)); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := schema.ValidateJSON([]byte(`2`)); err == nil {
+		t.Error("expected error for value matching both schemas")
+	}
+	if _, err := schema.ValidateJSON([]byte(`1 2`)); err == nil {
+		t.Error("expected error for trailing content")
+	}
+}
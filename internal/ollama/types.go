@@ -47,6 +47,9 @@ type GenerateRequest struct {
 	// Prompt is the textual prompt to send to the model.
 	Prompt string `json:"prompt"`
 
+	// Suffix is the text that comes after the inserted text.
+	Suffix string `json:"suffix,omitempty"`
+
 	// System overrides the model's default system message/prompt.
 	System string `json:"system"`
 
@@ -63,8 +66,9 @@ type GenerateRequest struct {
 	// Raw set to true means that no formatting will be applied to the prompt.
 	Raw bool `json:"raw,omitempty"`
 
-	// Format specifies the format to return a response in.
-	Format string `json:"format"`
+	// Format specifies the format to return a response in, either "json"
+	// or a JSON schema.
+	Format json.RawMessage `json:"format,omitempty"`
 
 	// KeepAlive controls how long the model will stay loaded in memory following
 	// this request.
@@ -90,8 +94,9 @@ type ChatRequest struct {
 	// Stream enable streaming of returned response; true by default.
 	Stream *bool `json:"stream,omitempty"`
 
-	// Format is the format to return the response in (e.g. "json").
-	Format string `json:"format"`
+	// Format is the format to return the response in, either "json" or a
+	// JSON schema.
+	Format json.RawMessage `json:"format,omitempty"`
 
 	// KeepAlive controls how long the model will stay loaded into memory
 	// followin the request.
@@ -485,6 +490,22 @@ func (m *Metrics) Summary() {
 	}
 }
 
+// OptionError is returned by [Options.FromMap] when an option value has the
+// wrong type. Callers that validate option names also use it for unknown options.
+type OptionError struct {
+	Option string `json:"option"`
+	// Expected is the expected type of the value, empty for unknown options.
+	Expected string      `json:"expected,omitempty"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+func (e *OptionError) Error() string {
+	if e.Expected == "" {
+		return fmt.Sprintf("unknown option %q", e.Option)
+	}
+	return fmt.Sprintf("option %q must be of type %s", e.Option, e.Expected)
+}
+
 func (opts *Options) FromMap(m map[string]interface{}) error {
 	valueOpts := reflect.ValueOf(opts).Elem() // names of the fields in the options struct
 	typeOpts := reflect.TypeOf(opts).Elem()   // types of the fields in the options struct
@@ -501,7 +522,7 @@ func (opts *Options) FromMap(m map[string]interface{}) error {
 	for key, val := range m {
 		opt, ok := jsonOpts[key]
 		if !ok {
-			log.Warn().Str("option", opt.Name).Msg("invalid option provided")
+			log.Warn().Str("option", key).Msg("invalid option provided")
 			continue
 		}
 
@@ -514,45 +535,50 @@ func (opts *Options) FromMap(m map[string]interface{}) error {
 			switch field.Kind() {
 			case reflect.Int:
 				switch t := val.(type) {
+				case int:
+					field.SetInt(int64(t))
 				case int64:
 					field.SetInt(t)
 				case float64:
 					// when JSON unmarshals numbers, it uses float64, not int
+					if t != math.Trunc(t) {
+						return &OptionError{Option: key, Expected: "integer", Value: val}
+					}
 					field.SetInt(int64(t))
 				default:
-					return fmt.Errorf("option %q must be of type integer", key)
+					return &OptionError{Option: key, Expected: "integer", Value: val}
 				}
 			case reflect.Bool:
-				val, ok := val.(bool)
+				b, ok := val.(bool)
 				if !ok {
-					return fmt.Errorf("option %q must be of type boolean", key)
+					return &OptionError{Option: key, Expected: "boolean", Value: val}
 				}
-				field.SetBool(val)
+				field.SetBool(b)
 			case reflect.Float32:
 				// JSON unmarshals to float64
-				val, ok := val.(float64)
+				f, ok := val.(float64)
 				if !ok {
-					return fmt.Errorf("option %q must be of type float32", key)
+					return &OptionError{Option: key, Expected: "float32", Value: val}
 				}
-				field.SetFloat(val)
+				field.SetFloat(f)
 			case reflect.String:
-				val, ok := val.(string)
+				str, ok := val.(string)
 				if !ok {
-					return fmt.Errorf("option %q must be of type string", key)
+					return &OptionError{Option: key, Expected: "string", Value: val}
 				}
-				field.SetString(val)
+				field.SetString(str)
 			case reflect.Slice:
 				// JSON unmarshals to []interface{}, not []string
-				val, ok := val.([]interface{})
+				items, ok := val.([]interface{})
 				if !ok {
-					return fmt.Errorf("option %q must be of type array", key)
+					return &OptionError{Option: key, Expected: "array of strings", Value: val}
 				}
 				// convert []interface{} to []string
-				slice := make([]string, len(val))
-				for i, item := range val {
+				slice := make([]string, len(items))
+				for i, item := range items {
 					str, ok := item.(string)
 					if !ok {
-						return fmt.Errorf("option %q must be of an array of strings", key)
+						return &OptionError{Option: key, Expected: "array of strings", Value: val}
 					}
 					slice[i] = str
 				}
@@ -560,11 +586,11 @@ func (opts *Options) FromMap(m map[string]interface{}) error {
 			case reflect.Pointer:
 				var b bool
 				if field.Type() == reflect.TypeOf(&b) {
-					val, ok := val.(bool)
+					b, ok := val.(bool)
 					if !ok {
-						return fmt.Errorf("option %q must be of type boolean", key)
+						return &OptionError{Option: key, Expected: "boolean", Value: val}
 					}
-					field.Set(reflect.ValueOf(&val))
+					field.Set(reflect.ValueOf(&b))
 				} else {
 					return fmt.Errorf("unknown type loading config params: %v %v", field.Kind(), field.Type())
 				}
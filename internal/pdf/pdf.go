@@ -0,0 +1,227 @@
+// Package pdf 提供一个仅支持纯文本排版的简单 PDF 生成器
+//
+// 文本使用 Adobe 预定义的 STSong-Light 字体及 UniGB-UCS2-H 编码输出，
+// 无需嵌入字体即可显示中英文内容，阅读器会使用本地的替代字体渲染。
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// A4 纸张尺寸，单位为点
+	PageWidth  = 595.0
+	PageHeight = 842.0
+
+	margin         = 50.0
+	lineSpacing    = 1.5
+	headingSize    = 16.0
+	subheadingSize = 13.0
+	bodySize       = 10.5
+	tabSize        = 4
+)
+
+type line struct {
+	text string
+	size float64
+	y    float64
+}
+
+// Document 纯文本 PDF 文档
+type Document struct {
+	pages [][]*line
+	// 当前页已使用的高度
+	cursor float64
+}
+
+func New() *Document {
+	d := &Document{}
+	d.PageBreak()
+	return d
+}
+
+// Heading 添加一级标题
+func (d *Document) Heading(text string) {
+	d.space(bodySize)
+	d.write(text, headingSize)
+	d.space(bodySize / 2)
+}
+
+// Subheading 添加二级标题
+func (d *Document) Subheading(text string) {
+	d.space(bodySize / 2)
+	d.write(text, subheadingSize)
+}
+
+// Paragraph 添加正文段落，段落中的换行会被保留
+func (d *Document) Paragraph(text string) {
+	d.write(text, bodySize)
+	d.space(bodySize / 2)
+}
+
+// PageBreak 开始新的一页
+func (d *Document) PageBreak() {
+	d.pages = append(d.pages, nil)
+	d.cursor = 0
+}
+
+func (d *Document) space(height float64) {
+	if d.cursor > 0 {
+		d.cursor += height
+	}
+}
+
+func (d *Document) write(text string, size float64) {
+	maxWidth := PageWidth - margin*2
+	for _, paragraph := range strings.Split(normalize(text), "\n") {
+		for _, text := range wrap(paragraph, size, maxWidth) {
+			height := size * lineSpacing
+			if d.cursor+height > PageHeight-margin*2 {
+				d.PageBreak()
+			}
+			d.cursor += height
+			page := len(d.pages) - 1
+			d.pages[page] = append(d.pages[page], &line{
+				text: text,
+				size: size,
+				y:    PageHeight - margin - d.cursor + (height-size)/2,
+			})
+		}
+	}
+}
+
+// 规范化文本，去除控制字符，替换 UCS-2 无法表示的字符
+func normalize(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\t", strings.Repeat(" ", tabSize))
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n':
+			return r
+		case r == utf8.RuneError, r > 0xFFFF:
+			return '?'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// 字符宽度，半角字符按半个字宽计算
+func runeWidth(r rune, size float64) float64 {
+	if r < 0x80 || (r >= 0xFF61 && r <= 0xFFDC) {
+		return size / 2
+	}
+	return size
+}
+
+// 按最大宽度折行，英文单词尽量不拆分
+func wrap(text string, size, maxWidth float64) []string {
+	if text == "" {
+		return []string{""}
+	}
+	var lines []string
+	runes := []rune(text)
+	start, width, lastSpace := 0, 0.0, -1
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		w := runeWidth(r, size)
+		if width+w > maxWidth && i > start {
+			if r == ' ' {
+				// 行尾的空格直接丢弃
+				lines = append(lines, strings.TrimRight(string(runes[start:i]), " "))
+				start, width, lastSpace = i+1, 0, -1
+				continue
+			}
+			end := i
+			if lastSpace > start && isWordRune(r) && isWordRune(runes[i-1]) {
+				end = lastSpace + 1
+			}
+			lines = append(lines, strings.TrimRight(string(runes[start:end]), " "))
+			start, width, lastSpace = end, 0, -1
+			for j := start; j < i; j++ {
+				width += runeWidth(runes[j], size)
+			}
+		}
+		if r == ' ' {
+			lastSpace = i
+		}
+		width += w
+	}
+	return append(lines, string(runes[start:]))
+}
+
+func isWordRune(r rune) bool {
+	return r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// 将文本编码为 UCS-2 大端十六进制字符串
+func encodeText(text string) string {
+	var builder strings.Builder
+	builder.WriteString("<")
+	for _, r := range text {
+		builder.WriteString(fmt.Sprintf("%04X", r))
+	}
+	builder.WriteString(">")
+	return builder.String()
+}
+
+// Bytes 生成 PDF 文件内容
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	d.WriteTo(&buf)
+	return buf.Bytes()
+}
+
+// WriteTo 将 PDF 文件内容写入 w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(content string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), content)
+	}
+
+	pageCount := len(d.pages)
+	// 对象编号：1 目录，2 页面树，3-5 字体，之后每页依次为页面与内容流
+	firstPage := 6
+	buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, pageCount)
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+i*2)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	object("<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>")
+	object("<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light " +
+		"/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> " +
+		"/FontDescriptor 5 0 R /DW 1000 /W [1 95 500 814 939 500] >>")
+	object("<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] " +
+		"/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>")
+	for i, lines := range d.pages {
+		var content strings.Builder
+		for _, line := range lines {
+			if line.text == "" {
+				continue
+			}
+			fmt.Fprintf(&content, "BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n", line.size, margin, line.y, encodeText(line.text))
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", PageWidth, PageHeight, firstPage+i*2+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
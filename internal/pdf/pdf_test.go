@@ -0,0 +1,49 @@
+package pdf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	cases := []struct {
+		text     string
+		maxWidth float64
+		expected []string
+	}{
+		{"", 100, []string{""}},
+		{"hello world", 100, []string{"hello world"}},
+		{"hello world", 30, []string{"hello", "world"}},
+		{"abcdefghij", 25, []string{"abcde", "fghij"}},
+		{"你好世界", 20, []string{"你好", "世界"}},
+		{"go 语言", 20, []string{"go", "语言"}},
+	}
+	for _, c := range cases {
+		lines := wrap(c.text, 10, c.maxWidth)
+		if strings.Join(lines, "|") != strings.Join(c.expected, "|") {
+			t.Errorf("wrap(%q, %v) = %q, expected %q", c.text, c.maxWidth, lines, c.expected)
+		}
+	}
+}
+
+func TestEncodeText(t *testing.T) {
+	if text := encodeText("A中"); text != "<00414E2D>" {
+		t.Errorf("encodeText = %s", text)
+	}
+}
+
+func TestDocument(t *testing.T) {
+	d := New()
+	d.Heading("标题 Title")
+	for i := 0; i < 100; i++ {
+		d.Paragraph("这是一段用于测试分页的正文内容 with some english words\n第二行")
+	}
+	content := d.Bytes()
+	if !bytes.HasPrefix(content, []byte("%PDF-1.4")) || !bytes.HasSuffix(content, []byte("%%EOF\n")) {
+		t.Fatal("invalid pdf content")
+	}
+	if len(d.pages) < 2 {
+		t.Errorf("expected multiple pages, got %d", len(d.pages))
+	}
+}